@@ -0,0 +1,292 @@
+// Command stackdbg steps through stack programs written in the format
+// stackvm.Show prints.
+//
+//	stackdbg [-vars 1,2.5] [file]
+//
+// The program is read from file, if given, or entered with the load command.
+// Files may also hold a program in the binary format of stackvm.Program.
+// Type help at the prompt for the list of commands.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"project/impl/stackvm"
+	"strconv"
+	"strings"
+)
+
+const usage = `commands:
+  load <program>      load a program in Show format and restart
+  step [n]            execute n instructions (default 1)
+  continue            run until the next breakpoint or the end
+  break <pc|op>       stop before the instruction at pc or every op instruction
+  delete <pc|op>      remove a breakpoint
+  stack               print the stack
+  list                print the program, > marks the next instruction
+  vars                print the variables
+  set x<n> <value>    bind a variable and restart
+  reset               restart the program
+  quit                leave the debugger
+`
+
+// debugger holds a loaded program and its current run. Breakpoints survive
+// restarts.
+type debugger struct {
+	out      io.Writer
+	code     []stackvm.Token
+	env      stackvm.Env
+	state    *stackvm.State
+	breakPCs map[int]bool
+	breakOps map[stackvm.Token]bool
+}
+
+func newDebugger(out io.Writer, env stackvm.Env) *debugger {
+	return &debugger{out: out, env: env, breakPCs: map[int]bool{}, breakOps: map[stackvm.Token]bool{}}
+}
+
+// load replaces the program with one in Show format and restarts.
+func (d *debugger) load(text string) error {
+	code, err := stackvm.Parse(text)
+	if err != nil {
+		return err
+	}
+	d.loadCode(code)
+	return nil
+}
+
+func (d *debugger) loadCode(code []stackvm.Token) {
+	if err := stackvm.Verify(code); err != nil {
+		fmt.Fprintf(d.out, "warning: %v\n", err)
+	}
+	d.code = code
+	d.reset()
+}
+
+// reset starts a new run of the program with a copy of the variables, so
+// assignments of earlier runs do not leak into the next one.
+func (d *debugger) reset() {
+	env := make(stackvm.Env, len(d.env))
+	copy(env, d.env)
+	d.state = stackvm.NewVM(d.code).Start(env)
+	for pc := range d.breakPCs {
+		d.state.BreakAt(pc)
+	}
+	for op := range d.breakOps {
+		d.state.BreakOn(op)
+	}
+}
+
+// exec runs a single command line and reports whether the debugger should
+// keep going.
+func (d *debugger) exec(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+	command, args := fields[0], fields[1:]
+
+	if d.state == nil {
+		switch command {
+		case "load", "set", "break", "delete", "help", "quit":
+		default:
+			fmt.Fprintln(d.out, "no program loaded")
+			return true
+		}
+	}
+
+	switch command {
+	case "load":
+		if err := d.load(strings.Join(args, " ")); err != nil {
+			fmt.Fprintln(d.out, err)
+			return true
+		}
+		d.printNext()
+	case "step", "s":
+		n := 1
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				fmt.Fprintf(d.out, "invalid step count %q\n", args[0])
+				return true
+			}
+		}
+		for i := 0; i < n && !d.state.Halted; i++ {
+			d.state.Step()
+		}
+		d.printNext()
+	case "continue", "c":
+		d.state.Continue()
+		d.printNext()
+	case "break", "b":
+		d.setBreakpoint(args, true)
+	case "delete", "d":
+		d.setBreakpoint(args, false)
+	case "stack":
+		fmt.Fprintln(d.out, d.state.Stack)
+	case "list", "l":
+		d.list()
+	case "vars":
+		for i, value := range d.state.Env {
+			fmt.Fprintf(d.out, "x%d = %g\n", i, value)
+		}
+	case "set":
+		d.set(args)
+	case "reset", "r":
+		d.reset()
+		d.printNext()
+	case "help", "h":
+		fmt.Fprint(d.out, usage)
+	case "quit", "q":
+		return false
+	default:
+		fmt.Fprintf(d.out, "unknown command %q, type help for a list\n", command)
+	}
+	return true
+}
+
+// setBreakpoint adds or removes a breakpoint in the debugger and in the
+// current run.
+func (d *debugger) setBreakpoint(args []string, on bool) {
+	if len(args) != 1 {
+		fmt.Fprintln(d.out, "expected a pc or an op")
+		return
+	}
+
+	if pc, err := strconv.Atoi(args[0]); err == nil {
+		if on {
+			d.breakPCs[pc] = true
+			if d.state != nil {
+				d.state.BreakAt(pc)
+			}
+		} else {
+			delete(d.breakPCs, pc)
+			if d.state != nil {
+				d.state.ClearAt(pc)
+			}
+		}
+		return
+	}
+
+	code, err := stackvm.Parse(args[0])
+	if err != nil || len(code) != 1 {
+		fmt.Fprintf(d.out, "unknown op %q\n", args[0])
+		return
+	}
+	op := code[0]
+	if on {
+		d.breakOps[op] = true
+		if d.state != nil {
+			d.state.BreakOn(op)
+		}
+	} else {
+		delete(d.breakOps, op)
+		if d.state != nil {
+			d.state.ClearOn(op)
+		}
+	}
+}
+
+func (d *debugger) set(args []string) {
+	if len(args) != 2 || !strings.HasPrefix(args[0], "x") {
+		fmt.Fprintln(d.out, "expected set x<n> <value>")
+		return
+	}
+	index, err := strconv.Atoi(args[0][1:])
+	if err != nil || index < 0 {
+		fmt.Fprintf(d.out, "invalid variable %q\n", args[0])
+		return
+	}
+	value, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		fmt.Fprintf(d.out, "invalid value %q\n", args[1])
+		return
+	}
+
+	for len(d.env) <= index {
+		d.env = append(d.env, 0)
+	}
+	d.env[index] = value
+	if d.state != nil {
+		d.reset()
+	}
+}
+
+func (d *debugger) list() {
+	for pc := 0; pc < len(d.code); {
+		marker := " "
+		if pc == d.state.PC && !d.state.Halted {
+			marker = ">"
+		}
+		if d.breakPCs[pc] || d.breakOps[d.code[pc]] {
+			marker += "*"
+		} else {
+			marker += " "
+		}
+
+		var instruction string
+		start := pc
+		instruction, pc = stackvm.ShowInstruction(d.code, pc)
+		fmt.Fprintf(d.out, "%s %4d | %s\n", marker, start, instruction)
+	}
+}
+
+// printNext shows where the run stopped.
+func (d *debugger) printNext() {
+	s := d.state
+	switch {
+	case s.Err != nil:
+		fmt.Fprintln(d.out, s.Err)
+	case s.Halted:
+		fmt.Fprintf(d.out, "halted after %d steps, result %g\n", s.Steps, s.Result)
+	default:
+		instruction, _ := stackvm.ShowInstruction(d.code, s.PC)
+		fmt.Fprintf(d.out, "%4d | %-8s | %v\n", s.PC, instruction, s.Stack)
+	}
+}
+
+func main() {
+	vars := flag.String("vars", "", "comma separated values of x0, x1, ...")
+	flag.Parse()
+
+	var env stackvm.Env
+	if *vars != "" {
+		for _, field := range strings.Split(*vars, ",") {
+			value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid variable value %q\n", field)
+				os.Exit(2)
+			}
+			env = append(env, value)
+		}
+	}
+
+	d := newDebugger(os.Stdout, env)
+	if flag.NArg() > 0 {
+		text, err := os.ReadFile(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// binary programs from stackvm.Program, text otherwise
+		var p stackvm.Program
+		if p.UnmarshalBinary(text) == nil {
+			d.loadCode(p.Code)
+		} else if err := d.load(string(text)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		d.printNext()
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("(stackdbg) ")
+		if !scanner.Scan() || !d.exec(scanner.Text()) {
+			return
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"project/impl/stackvm"
+	"strings"
+	"testing"
+)
+
+func TestDebugger(t *testing.T) {
+	var out strings.Builder
+	d := newDebugger(&out, stackvm.Env{4})
+
+	for _, line := range []string{"load x0 2 + 2 *", "break *", "step", "continue", "stack"} {
+		if !d.exec(line) {
+			t.Fatalf("%s: debugger quit", line)
+		}
+	}
+	if d.state.PC != 5 || len(d.state.Stack) != 2 || d.state.Stack[0] != 6 {
+		t.Fatalf("expected break at pc 5 with stack [6 2], got %+v\n%s", d.state, out.String())
+	}
+
+	d.exec("delete *")
+	d.exec("continue")
+	if !d.state.Halted || d.state.Result != 12 {
+		t.Errorf("expected result 12, got %+v\n%s", d.state, out.String())
+	}
+
+	d.exec("set x0 1")
+	d.exec("continue")
+	if d.state.Result != 6 {
+		t.Errorf("expected result 6 after set, got %+v\n%s", d.state, out.String())
+	}
+
+	if d.exec("quit") {
+		t.Error("expected quit to stop the debugger")
+	}
+}
@@ -15,75 +15,144 @@ const (
 	TokenMult     ExpType = 2
 	TokenDiv      ExpType = 3
 	TokenDontCare ExpType = 4
+	TokenMinus    ExpType = 5
+	TokenNeg      ExpType = 6
+	TokenMod      ExpType = 7
+	TokenVar      ExpType = 8
+	TokenAssign   ExpType = 9
+	TokenIf       ExpType = 10 // left subtree is the condition, right subtree a TokenBranch
+	TokenBranch   ExpType = 11 // left and right subtree are the then and else expression
+	TokenEq       ExpType = 12
+	TokenLt       ExpType = 13
 )
 
 type EncodedExp struct {
 	Type  int
-	Value int // Only used for TokenInt
+	Value int // Only used for TokenInt and the variable index of TokenVar and TokenAssign
 }
 
 func EncodeWithDepth(exp stackvm.Exp, maxDepth, currentDepth int) ([]EncodedExp, error) {
-	var tokens []EncodedExp
-
-	var helper func(e stackvm.Exp, depth int) error
-	helper = func(e stackvm.Exp, depth int) error {
-		if depth >= maxDepth {
-			switch v := e.(type) {
-			case *stackvm.IntExp:
-				tokens = append(tokens, EncodedExp{Type: 0, Value: v.Value})
-			default:
-				return fmt.Errorf("unexpected non-terminal at max depth: %v", reflect.TypeOf(e))
-			}
-			return nil
-		}
+	e := &encoder{maxDepth: maxDepth}
+	if err := e.encode(exp, currentDepth); err != nil {
+		return nil, err
+	}
+	return e.tokens, nil
+}
 
-		switch v := e.(type) {
-		case *stackvm.IntExp:
-			tokens = append(tokens, EncodedExp{Type: 0, Value: v.Value})
-			// Add padding for remaining depth
-			padding := calc_padding(maxDepth - depth)
-			for i := 0; i < padding; i++ {
-				tokens = append(tokens, EncodedExp{Type: 4})
-			}
+// encoder is the Visitor behind EncodeWithDepth. depth is the depth of the
+// node it visits, err the first error.
+type encoder struct {
+	tokens   []EncodedExp
+	maxDepth int
+	depth    int
+	err      error
+}
 
-		case *stackvm.PlusExp:
-			tokens = append(tokens, EncodedExp{Type: 1})
-			if err := helper(v.Left, depth+1); err != nil {
-				return err
-			}
-			if err := helper(v.Right, depth+1); err != nil {
-				return err
-			}
+func (e *encoder) encode(exp stackvm.Exp, depth int) error {
+	if e.err != nil {
+		return e.err
+	}
+	outer := e.depth
+	e.depth = depth
+	exp.Accept(e)
+	e.depth = outer
+	return e.err
+}
 
-		case *stackvm.MultExp:
-			tokens = append(tokens, EncodedExp{Type: 2})
-			if err := helper(v.Right, depth+1); err != nil {
-				return err
-			}
-			if err := helper(v.Right, depth+1); err != nil {
-				return err
-			}
+// add appends a token and the padding that follows it.
+func (e *encoder) add(token EncodedExp, padding int) {
+	e.tokens = append(e.tokens, token)
+	for i := 0; i < padding; i++ {
+		e.tokens = append(e.tokens, EncodedExp{Type: 4})
+	}
+}
 
-		case *stackvm.DivExp:
-			tokens = append(tokens, EncodedExp{Type: 3})
-			if err := helper(v.Left, depth+1); err != nil {
-				return err
-			}
-			if err := helper(v.Right, depth+1); err != nil {
-				return err
-			}
+// terminal appends a leaf and the padding for the remaining depth.
+func (e *encoder) terminal(token EncodedExp) {
+	if e.depth >= e.maxDepth {
+		e.add(token, 0)
+		return
+	}
+	e.add(token, calc_padding(e.maxDepth-e.depth))
+}
 
-		default:
-			return fmt.Errorf("unsupported expression type: %v", reflect.TypeOf(e))
+// nonTerminal appends an operator node and its children, or fails at max depth.
+func (e *encoder) nonTerminal(exp stackvm.Exp, token EncodedExp, children ...stackvm.Exp) {
+	if e.depth >= e.maxDepth {
+		e.err = fmt.Errorf("unexpected non-terminal at max depth: %v", reflect.TypeOf(exp))
+		return
+	}
+	e.add(token, 0)
+	for _, child := range children {
+		if e.encode(child, e.depth+1) != nil {
+			return
 		}
-		return nil
 	}
+}
 
-	if err := helper(exp, currentDepth); err != nil {
-		return nil, err
+// unary appends a node with a single child, padding the unused right subtree.
+func (e *encoder) unary(exp stackvm.Exp, token EncodedExp, operand stackvm.Exp) {
+	e.nonTerminal(exp, token, operand)
+	if e.err == nil {
+		e.add(EncodedExp{Type: 4}, calc_padding(e.maxDepth-e.depth-1))
 	}
+}
+
+func (e *encoder) VisitInt(v *stackvm.IntExp) { e.terminal(EncodedExp{Type: 0, Value: int(v.Value)}) }
+func (e *encoder) VisitVar(v *stackvm.VarExp) { e.terminal(EncodedExp{Type: 8, Value: int(v.Index)}) }
+
+func (e *encoder) VisitPlus(v *stackvm.PlusExp) {
+	e.nonTerminal(v, EncodedExp{Type: 1}, v.Left, v.Right)
+}
+
+func (e *encoder) VisitMult(v *stackvm.MultExp) {
+	e.nonTerminal(v, EncodedExp{Type: 2}, v.Left, v.Right)
+}
 
-	return tokens, nil
+func (e *encoder) VisitDiv(v *stackvm.DivExp) {
+	e.nonTerminal(v, EncodedExp{Type: 3}, v.Left, v.Right)
+}
+
+func (e *encoder) VisitMinus(v *stackvm.MinusExp) {
+	e.nonTerminal(v, EncodedExp{Type: 5}, v.Left, v.Right)
+}
+
+func (e *encoder) VisitNeg(v *stackvm.NegExp) {
+	e.unary(v, EncodedExp{Type: 6}, v.Operand)
+}
+
+func (e *encoder) VisitAssign(v *stackvm.AssignExp) {
+	e.unary(v, EncodedExp{Type: 9, Value: int(v.Index)}, v.Value)
+}
+
+func (e *encoder) VisitMod(v *stackvm.ModExp) {
+	e.nonTerminal(v, EncodedExp{Type: 7}, v.Left, v.Right)
+}
+
+func (e *encoder) VisitEq(v *stackvm.EqExp) {
+	e.nonTerminal(v, EncodedExp{Type: 12}, v.Left, v.Right)
+}
+
+func (e *encoder) VisitLt(v *stackvm.LtExp) {
+	e.nonTerminal(v, EncodedExp{Type: 13}, v.Left, v.Right)
+}
+
+func (e *encoder) VisitIf(v *stackvm.IfExp) {
+	e.nonTerminal(v, EncodedExp{Type: 10}, v.Cond)
+	if e.err != nil {
+		return
+	}
+	// Three children do not fit a binary tree, so the branches
+	// hang off a TokenBranch node in the right subtree
+	if e.depth+1 >= e.maxDepth {
+		e.err = fmt.Errorf("unexpected non-terminal at max depth: %v", reflect.TypeOf(v))
+		return
+	}
+	e.add(EncodedExp{Type: 11}, 0)
+	if e.encode(v.Then, e.depth+2) != nil {
+		return
+	}
+	e.encode(v.Else, e.depth+2)
 }
 
 func calc_padding(remaining_layers int) int {
@@ -101,6 +170,20 @@ func calc_padding(remaining_layers int) int {
 func Decode(tokens []EncodedExp, maxDepth int, resilient bool) (stackvm.Exp, error) {
 	var parse func(*int, int) (stackvm.Exp, error)
 
+	// consumePadding skips n DontCare tokens
+	consumePadding := func(pos *int, n int) error {
+		for i := 0; i < n; i++ {
+
+			if *pos >= len(tokens) || tokens[*pos].Type != 4 {
+				if !resilient {
+					return fmt.Errorf("unexpected token at padding position %v", *pos)
+				}
+			}
+			*pos++ // Consume the DontCare token
+		}
+		return nil
+	}
+
 	parse = func(pos *int, currentDepth int) (stackvm.Exp, error) {
 		if *pos >= len(tokens) {
 			return nil, fmt.Errorf("unexpected end of tokens")
@@ -113,33 +196,116 @@ func Decode(tokens []EncodedExp, maxDepth int, resilient bool) (stackvm.Exp, err
 		switch token.Type {
 		case 0: // Handle terminal nodes (IntExp)
 
-			// ensure that the value is 1 or 2
-			if token.Value != 1 && token.Value != 2 {
+			// Create a terminal node (IntExp), any value is valid
+			intExp := &stackvm.IntExp{Value: int64(token.Value)}
+
+			// Consume padding for remaining depth
+			if err := consumePadding(pos, calc_padding(maxDepth-currentDepth)); err != nil {
+				return nil, err
+			}
+
+			return intExp, nil
+
+		case 8: // Handle terminal nodes (VarExp)
+
+			// ensure that the variable index is not negative
+			if token.Value < 0 {
 				if resilient {
-					token.Value = 1
+					token.Value = 0
 				} else {
-					return nil, fmt.Errorf("invalid value for IntExp: %v", token.Value)
+					return nil, fmt.Errorf("invalid index for VarExp: %v", token.Value)
 				}
 			}
 
-			// Create a terminal node (IntExp)
-			intExp := &stackvm.IntExp{Value: token.Value}
+			varExp := &stackvm.VarExp{Index: int64(token.Value)}
 
 			// Consume padding for remaining depth
-			expectedPadding := calc_padding(maxDepth - currentDepth)
-			for i := 0; i < expectedPadding; i++ {
+			if err := consumePadding(pos, calc_padding(maxDepth-currentDepth)); err != nil {
+				return nil, err
+			}
 
-				if *pos >= len(tokens) || tokens[*pos].Type != 4 {
-					if !resilient {
-						return nil, fmt.Errorf("unexpected token at padding position %v", *pos)
-					}
+			return varExp, nil
+
+		case 6, 9: // Handle unary nodes (NegExp, AssignExp)
+			if currentDepth >= maxDepth {
+				if resilient {
+					return &stackvm.IntExp{Value: 1}, nil
+				} else {
+					return nil, fmt.Errorf("unexpected non-terminal token at max depth")
 				}
-				*pos++ // Consume the DontCare token
 			}
 
-			return intExp, nil
+			// ensure that the variable index is not negative
+			if token.Type == 9 && token.Value < 0 {
+				if resilient {
+					token.Value = 0
+				} else {
+					return nil, fmt.Errorf("invalid index for AssignExp: %v", token.Value)
+				}
+			}
+
+			operand, err := parse(pos, currentDepth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			// Consume padding for the unused right subtree
+			if err := consumePadding(pos, 1+calc_padding(maxDepth-currentDepth-1)); err != nil {
+				return nil, err
+			}
+
+			if token.Type == 9 {
+				return &stackvm.AssignExp{Index: int64(token.Value), Value: operand}, nil
+			}
+			return &stackvm.NegExp{Operand: operand}, nil
+
+		case 10: // Handle conditional nodes (IfExp)
+			if currentDepth >= maxDepth {
+				if resilient {
+					return &stackvm.IntExp{Value: 1}, nil
+				} else {
+					return nil, fmt.Errorf("unexpected non-terminal token at max depth")
+				}
+			}
+
+			cond, err := parse(pos, currentDepth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			// The right subtree must be a branch node holding then and else
+			if *pos < len(tokens) && tokens[*pos].Type == 11 && currentDepth+1 < maxDepth {
+				*pos++ // Consume the branch token
+
+				then, err := parse(pos, currentDepth+2)
+				if err != nil {
+					return nil, err
+				}
+
+				els, err := parse(pos, currentDepth+2)
+				if err != nil {
+					return nil, err
+				}
+
+				return &stackvm.IfExp{Cond: cond, Then: then, Else: els}, nil
+			}
+
+			if !resilient {
+				return nil, fmt.Errorf("expected branch token at position %v", *pos)
+			}
+
+			// Use whatever the right subtree holds for both branches
+			branch, err := parse(pos, currentDepth+1)
+			if err != nil {
+				return nil, err
+			}
+			return &stackvm.IfExp{Cond: cond, Then: branch, Else: branch}, nil
+
+		case 1, 2, 3, 5, 7, 11, 12, 13: // Handle non-terminal nodes (PlusExp, MultExp, DivExp, MinusExp, ModExp, EqExp, LtExp)
+			if token.Type == 11 && !resilient {
+				return nil, fmt.Errorf("unexpected branch token outside of conditional")
+			}
 
-		case 1, 2, 3: // Handle non-terminal nodes (PlusExp, MultExp, DivExp)
 			if currentDepth >= maxDepth {
 				if resilient {
 					return &stackvm.IntExp{Value: 1}, nil
@@ -168,6 +334,17 @@ func Decode(tokens []EncodedExp, maxDepth int, resilient bool) (stackvm.Exp, err
 				return &stackvm.MultExp{Left: left, Right: right}, nil
 			case 3:
 				return &stackvm.DivExp{Left: left, Right: right}, nil
+			case 5:
+				return &stackvm.MinusExp{Left: left, Right: right}, nil
+			case 7:
+				return &stackvm.ModExp{Left: left, Right: right}, nil
+			case 11:
+				// a stray branch node yields its then expression
+				return left, nil
+			case 12:
+				return &stackvm.EqExp{Left: left, Right: right}, nil
+			case 13:
+				return &stackvm.LtExp{Left: left, Right: right}, nil
 			}
 		}
 		return nil, fmt.Errorf("unknown token type to decode: %v", token.Type)
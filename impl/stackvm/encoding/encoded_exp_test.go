@@ -1,6 +1,7 @@
 package encoding
 
 import (
+	"math"
 	"math/rand"
 	"testing"
 
@@ -29,14 +30,61 @@ func TestEncodeDecode(t *testing.T) {
 	vm2 := stackvm.NewVM(vmCode)   // create a new VM instance
 	expression2 := vm2.Convert()   // convert the VM code back to an expression
 
-	resultFromExp := decodedExp.Eval()
-	resultFromVM := expression2.Eval()
+	resultFromExp := decodedExp.Eval(nil)
+	resultFromVM := expression2.Eval(nil)
 	t.Logf("Result from VM: %g", resultFromVM)
 	t.Logf("Result from Expression: %g", resultFromExp)
 
 	// assert that Exp.eval == Exp2.eval
-	if resultFromExp != resultFromVM {
+	if resultFromExp != resultFromVM && !(math.IsNaN(resultFromExp) && math.IsNaN(resultFromVM)) {
 		t.Errorf("Mismatch: original evaluation = %g, VM evaluation = %g", resultFromExp, resultFromVM)
 	}
 	t.Logf("Decoded expression: %s", decodedExp)
 }
+
+func TestEncodeDecodeOperators(t *testing.T) {
+	exps := []stackvm.Exp{
+		stackvm.NewMinusExp(
+			stackvm.NewNegExp(stackvm.NewModExp(stackvm.NewIntExp(-7), stackvm.NewIntExp(3))),
+			stackvm.NewIfExp(
+				stackvm.NewLtExp(stackvm.NewVarExp(0), stackvm.NewIntExp(0)),
+				stackvm.NewAssignExp(1, stackvm.NewVarExp(0)),
+				stackvm.NewEqExp(stackvm.NewVarExp(0), stackvm.NewIntExp(2)))),
+		// operands that differ, so swapped or repeated ones show
+		stackvm.NewMultExp(stackvm.NewIntExp(3), stackvm.NewIntExp(5)),
+		stackvm.NewDivExp(stackvm.NewIntExp(3), stackvm.NewIntExp(5)),
+	}
+
+	for _, exp := range exps {
+		for maxDepth := 4; maxDepth <= 5; maxDepth++ {
+			encodedExp, err := EncodeWithDepth(exp, maxDepth, 0)
+			if err != nil {
+				t.Fatalf("Failed to encode expression: %v", err)
+			}
+			if len(encodedExp) != 1+calc_padding(maxDepth) {
+				t.Errorf("Expected %d tokens, got %d", 1+calc_padding(maxDepth), len(encodedExp))
+			}
+
+			decodedExp, err := Decode(encodedExp, maxDepth, false)
+			if err != nil {
+				t.Fatalf("Failed to decode expression: %v", err)
+			}
+			if !stackvm.Equal(decodedExp, exp) {
+				t.Errorf("Expected %s, got %s", stackvm.ShowParens(exp), stackvm.ShowParens(decodedExp))
+			}
+		}
+	}
+}
+
+func TestEncodeValueReceivers(t *testing.T) {
+	one, two := stackvm.NewIntExp(1), stackvm.NewIntExp(2)
+	for _, exp := range []stackvm.Exp{stackvm.MultExp{Left: one, Right: two}, stackvm.DivExp{Left: one, Right: two}} {
+		encodedExp, err := EncodeWithDepth(exp, 2, 0)
+		if err != nil {
+			t.Fatalf("Failed to encode %#v: %v", exp, err)
+		}
+		if len(encodedExp) != 1+calc_padding(2) {
+			t.Errorf("Expected %d tokens, got %d", 1+calc_padding(2), len(encodedExp))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package stackvm
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+)
+
+// Kinds of nodes as Equal and Hash see them. Their values are part of the
+// hashes, so they must not change.
+const (
+	kindNil byte = iota
+	kindInt
+	kindVar
+	kindAssign
+	kindPlus
+	kindMult
+	kindDiv
+	kindMinus
+	kindNeg
+	kindMod
+	kindEq
+	kindLt
+	kindIf
+)
+
+// shape is a node without its type: the kind, the integer field of IntExp,
+// VarExp and AssignExp, and the children in the order of their fields.
+type shape struct {
+	kind     byte
+	value    int64
+	children []Exp
+}
+
+// shapeOf is the shape of exp, which may be nil. The shaper escapes through
+// Accept, so every call allocates once.
+func shapeOf(exp Exp) shape {
+	var s shaper
+	if exp != nil {
+		exp.Accept(&s)
+	}
+	return s.shape
+}
+
+// shaper is the Visitor behind shapeOf.
+type shaper struct {
+	shape
+	store [3]Exp // backs children, so they cost no allocation beyond the shaper
+}
+
+func (s *shaper) set(kind byte, value int64, children ...Exp) {
+	s.kind, s.value = kind, value
+	s.children = append(s.store[:0], children...)
+}
+
+func (s *shaper) VisitInt(exp *IntExp)       { s.set(kindInt, exp.Value) }
+func (s *shaper) VisitVar(exp *VarExp)       { s.set(kindVar, exp.Index) }
+func (s *shaper) VisitAssign(exp *AssignExp) { s.set(kindAssign, exp.Index, exp.Value) }
+func (s *shaper) VisitPlus(exp *PlusExp)     { s.set(kindPlus, 0, exp.Left, exp.Right) }
+func (s *shaper) VisitMult(exp *MultExp)     { s.set(kindMult, 0, exp.Left, exp.Right) }
+func (s *shaper) VisitDiv(exp *DivExp)       { s.set(kindDiv, 0, exp.Left, exp.Right) }
+func (s *shaper) VisitMinus(exp *MinusExp)   { s.set(kindMinus, 0, exp.Left, exp.Right) }
+func (s *shaper) VisitNeg(exp *NegExp)       { s.set(kindNeg, 0, exp.Operand) }
+func (s *shaper) VisitMod(exp *ModExp)       { s.set(kindMod, 0, exp.Left, exp.Right) }
+func (s *shaper) VisitEq(exp *EqExp)         { s.set(kindEq, 0, exp.Left, exp.Right) }
+func (s *shaper) VisitLt(exp *LtExp)         { s.set(kindLt, 0, exp.Left, exp.Right) }
+func (s *shaper) VisitIf(exp *IfExp)         { s.set(kindIf, 0, exp.Cond, exp.Then, exp.Else) }
+
+// Equal reports whether a and b are the same tree: nodes of the same types
+// with the same fields, no matter whether MultExp and DivExp nodes are stored
+// as values or as pointers. Nil expressions only equal nil.
+func Equal(a, b Exp) bool {
+	sa, sb := shapeOf(a), shapeOf(b)
+	if sa.kind != sb.kind || sa.value != sb.value {
+		return false
+	}
+	for i := range sa.children {
+		if !Equal(sa.children[i], sb.children[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash returns a hash of the tree of exp, so Equal expressions have the same
+// hash. It is 64-bit FNV-1a of the nodes in prefix order and does not depend
+// on the process, so hashes can key persistent caches.
+func Hash(exp Exp) uint64 {
+	h := fnv.New64a()
+	hashInto(h, exp)
+	return h.Sum64()
+}
+
+func hashInto(h hash.Hash64, exp Exp) {
+	s := shapeOf(exp)
+	var buf [1 + binary.MaxVarintLen64]byte
+	buf[0] = s.kind
+	h.Write(binary.AppendVarint(buf[:1], s.value))
+	for _, child := range s.children {
+		hashInto(h, child)
+	}
+}
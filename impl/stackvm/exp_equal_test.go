@@ -0,0 +1,63 @@
+package stackvm_test
+
+import (
+	"math/rand"
+	"project/impl/stackvm"
+	gen "project/impl/stackvm/generator"
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	one, two, x0 := stackvm.NewIntExp(1), stackvm.NewIntExp(2), stackvm.NewVarExp(0)
+	cases := []struct {
+		a, b  stackvm.Exp
+		equal bool
+	}{
+		{stackvm.NewPlusExp(one, x0), stackvm.NewPlusExp(stackvm.NewIntExp(1), stackvm.NewVarExp(0)), true},
+		{stackvm.NewPlusExp(one, x0), stackvm.NewPlusExp(x0, one), false},
+		{stackvm.NewPlusExp(one, two), stackvm.NewMinusExp(one, two), false},
+		{stackvm.NewDivExp(one, two), stackvm.DivExp{Left: one, Right: two}, true},
+		{stackvm.MultExp{Left: one, Right: two}, &stackvm.MultExp{Left: one, Right: two}, true},
+		{stackvm.NewDivExp(one, two), stackvm.NewDivExp(two, one), false},
+		{stackvm.NewVarExp(1), stackvm.NewIntExp(1), false},
+		{stackvm.NewAssignExp(0, one), stackvm.NewAssignExp(1, one), false},
+		{stackvm.NewIfExp(x0, one, two), stackvm.NewIfExp(x0, one, two), true},
+		{stackvm.NewIfExp(x0, one, two), stackvm.NewIfExp(x0, two, one), false},
+		{nil, nil, true},
+		{nil, one, false},
+	}
+
+	for _, c := range cases {
+		if stackvm.Equal(c.a, c.b) != c.equal {
+			t.Errorf("Equal(%v, %v): expected %v", c.a, c.b, c.equal)
+		}
+		if c.equal && stackvm.Hash(c.a) != stackvm.Hash(c.b) {
+			t.Errorf("%v and %v are equal but hash differently", c.a, c.b)
+		}
+	}
+}
+
+func TestHashStable(t *testing.T) {
+	// hashes key persistent caches, so they must not change
+	exp := stackvm.NewDivExp(stackvm.NewVarExp(0), stackvm.NewNegExp(stackvm.NewIntExp(7)))
+	if hash := stackvm.Hash(exp); hash != 0xb177a9fce803323a {
+		t.Errorf("expected hash 0xb177a9fce803323a, got %#x", hash)
+	}
+}
+
+func TestConvertEqual(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	hashes := map[uint64]stackvm.Exp{}
+	for range 500 {
+		exp := gen.RandomExpWithVars(rand, 4, 2)
+		converted := stackvm.NewVM(exp.Convert()).Convert()
+		if !stackvm.Equal(converted, exp) {
+			t.Errorf("%s: round trip yields %s", stackvm.ShowParens(exp), stackvm.ShowParens(converted))
+		}
+
+		if other, ok := hashes[stackvm.Hash(exp)]; ok && !stackvm.Equal(other, exp) {
+			t.Errorf("%s and %s hash alike", stackvm.ShowParens(exp), stackvm.ShowParens(other))
+		}
+		hashes[stackvm.Hash(exp)] = exp
+	}
+}
@@ -0,0 +1,73 @@
+package stackvm
+
+import "fmt"
+
+// TryEval evaluates exp like Eval, but reports reading or assigning an
+// unbound variable as an error wrapping ErrUnboundVariable, like VM.RunWith
+// does, instead of evaluating it to NaN. Variables in branches of an IfExp
+// that are not taken are not reported, the VM never executes them either.
+func TryEval(exp Exp, env Env) (float64, error) {
+	c := checker{unbound: -1}
+	result := Fold[Exp](exp, &c).Eval(env)
+	if c.unbound >= 0 {
+		return 0, fmt.Errorf("x%d: %w", c.unbound, ErrUnboundVariable)
+	}
+	return result, nil
+}
+
+// checker folds an expression into a copy whose variables record the first
+// unbound one they evaluate.
+type checker struct {
+	unbound int64 // index of the first unbound variable, -1 while there is none
+}
+
+func (c *checker) check(env Env, index int64) {
+	if _, ok := env.lookup(index); !ok && c.unbound < 0 {
+		c.unbound = index
+	}
+}
+
+func (c *checker) Int(exp *IntExp) Exp { return exp }
+func (c *checker) Var(exp *VarExp) Exp { return checkedVar{exp, c} }
+
+func (c *checker) Assign(exp *AssignExp, value Exp) Exp {
+	return NewAssignExp(exp.Index, assigned{value, exp.Index, c})
+}
+
+func (c *checker) Plus(_ *PlusExp, left, right Exp) Exp   { return NewPlusExp(left, right) }
+func (c *checker) Mult(_ *MultExp, left, right Exp) Exp   { return NewMultExp(left, right) }
+func (c *checker) Div(_ *DivExp, left, right Exp) Exp     { return NewDivExp(left, right) }
+func (c *checker) Minus(_ *MinusExp, left, right Exp) Exp { return NewMinusExp(left, right) }
+func (c *checker) Neg(_ *NegExp, operand Exp) Exp         { return NewNegExp(operand) }
+func (c *checker) Mod(_ *ModExp, left, right Exp) Exp     { return NewModExp(left, right) }
+func (c *checker) Eq(_ *EqExp, left, right Exp) Exp       { return NewEqExp(left, right) }
+func (c *checker) Lt(_ *LtExp, left, right Exp) Exp       { return NewLtExp(left, right) }
+
+func (c *checker) If(_ *IfExp, cond, then, els Exp) Exp {
+	return NewIfExp(cond, then, els)
+}
+
+// checkedVar is a VarExp that reports to its checker when it is unbound.
+type checkedVar struct {
+	*VarExp
+	c *checker
+}
+
+func (exp checkedVar) Eval(env Env) float64 {
+	exp.c.check(env, exp.Index)
+	return exp.VarExp.Eval(env)
+}
+
+// assigned is the value of an AssignExp. It reports to its checker when the
+// variable is unbound, after the value was evaluated like the VM does.
+type assigned struct {
+	Exp
+	index int64
+	c     *checker
+}
+
+func (exp assigned) Eval(env Env) float64 {
+	value := exp.Exp.Eval(env)
+	exp.c.check(env, exp.index)
+	return value
+}
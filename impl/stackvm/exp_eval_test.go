@@ -0,0 +1,53 @@
+package stackvm_test
+
+import (
+	"errors"
+	"math/rand"
+	"project/impl/stackvm"
+	gen "project/impl/stackvm/generator"
+	"testing"
+)
+
+func TestTryEval(t *testing.T) {
+	// x0 = x1 + 2; x0 * x0
+	exp := stackvm.NewMultExp(
+		stackvm.NewAssignExp(0, stackvm.NewPlusExp(stackvm.NewVarExp(1), stackvm.NewIntExp(2))),
+		stackvm.NewVarExp(0))
+
+	env := stackvm.Env{0, 5}
+	if result, err := stackvm.TryEval(exp, env); err != nil || result != 49 || env[0] != 7 {
+		t.Errorf("expected 49 and x0 = 7, got %g, %v and x0 = %g", result, err, env[0])
+	}
+
+	// the read of x1 comes before the assignment of x0
+	_, err := stackvm.TryEval(exp, nil)
+	if !errors.Is(err, stackvm.ErrUnboundVariable) || err.Error() != "x1: unbound variable" {
+		t.Errorf("expected x1: %v, got %v", stackvm.ErrUnboundVariable, err)
+	}
+	if _, err := stackvm.TryEval(exp, stackvm.Env{0}); !errors.Is(err, stackvm.ErrUnboundVariable) {
+		t.Errorf("expected %v, got %v", stackvm.ErrUnboundVariable, err)
+	}
+
+	// branches that are not taken may read anything
+	exp = stackvm.NewIfExp(stackvm.NewIntExp(1), stackvm.NewIntExp(3), stackvm.NewVarExp(9))
+	if result, err := stackvm.TryEval(exp, nil); err != nil || result != 3 {
+		t.Errorf("expected 3, got %g, %v", result, err)
+	}
+}
+
+func TestTryEvalMatchesVM(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for range 1000 {
+		exp := gen.RandomExpWithVars(rand, 4, 3)
+		if stackvm.Stats(exp).Ops["div"] > 0 {
+			// DivExp.Eval skips most divisions, see TestDivBug
+			continue
+		}
+		env := make(stackvm.Env, rand.Intn(4))
+		_, err := stackvm.TryEval(exp, append(stackvm.Env{}, env...))
+		_, vmErr := stackvm.NewVM(exp.Convert()).RunWith(env)
+		if errors.Is(err, stackvm.ErrUnboundVariable) != errors.Is(vmErr, stackvm.ErrUnboundVariable) {
+			t.Errorf("%s with %d variables: TryEval reports %v, the VM %v", exp, len(env), err, vmErr)
+		}
+	}
+}
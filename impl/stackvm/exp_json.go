@@ -0,0 +1,213 @@
+package stackvm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrBadExpJSON is reported for JSON that does not describe an expression.
+var ErrBadExpJSON = errors.New("invalid expression JSON")
+
+// jsonExp is the JSON form of every node, see UnmarshalExp.
+type jsonExp struct {
+	Op      string `json:"op"`
+	Index   *int64 `json:"index,omitempty"`
+	Value   any    `json:"value,omitempty"` // int64 or Exp
+	Left    Exp    `json:"left,omitempty"`
+	Right   Exp    `json:"right,omitempty"`
+	Operand Exp    `json:"operand,omitempty"`
+	Cond    Exp    `json:"cond,omitempty"`
+	Then    Exp    `json:"then,omitempty"`
+	Else    Exp    `json:"else,omitempty"`
+}
+
+// jsonWire is jsonExp before its children are decoded.
+type jsonWire struct {
+	Op      string          `json:"op"`
+	Index   *int64          `json:"index"`
+	Value   json.RawMessage `json:"value"`
+	Left    json.RawMessage `json:"left"`
+	Right   json.RawMessage `json:"right"`
+	Operand json.RawMessage `json:"operand"`
+	Cond    json.RawMessage `json:"cond"`
+	Then    json.RawMessage `json:"then"`
+	Else    json.RawMessage `json:"else"`
+}
+
+var binaryOps = map[string]func(left, right Exp) Exp{
+	"plus":  NewPlusExp,
+	"mult":  NewMultExp,
+	"div":   NewDivExp,
+	"minus": NewMinusExp,
+	"mod":   NewModExp,
+	"eq":    NewEqExp,
+	"lt":    NewLtExp,
+}
+
+// UnmarshalExp decodes an expression of any type. The MarshalJSON methods of
+// the nodes encode them as objects tagged with their op:
+//
+//	{"op": "int", "value": 7}
+//	{"op": "var", "index": 0}
+//	{"op": "assign", "index": 0, "value": {...}}
+//	{"op": "plus", "left": {...}, "right": {...}}
+//	{"op": "neg", "operand": {...}}
+//	{"op": "if", "cond": {...}, "then": {...}, "else": {...}}
+//
+// The other binary ops are mult, div, minus, mod, eq and lt. Left and right
+// are the fields of the same name, so the left of a div is its divisor.
+func UnmarshalExp(data []byte) (Exp, error) {
+	var wire jsonWire
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadExpJSON, err)
+	}
+
+	child := func(name string, raw json.RawMessage) (Exp, error) {
+		if len(raw) == 0 || string(raw) == "null" {
+			return nil, fmt.Errorf("%w: %s without %s", ErrBadExpJSON, wire.Op, name)
+		}
+		return UnmarshalExp(raw)
+	}
+	index := func() (int64, error) {
+		if wire.Index == nil {
+			return 0, fmt.Errorf("%w: %s without index", ErrBadExpJSON, wire.Op)
+		}
+		return *wire.Index, nil
+	}
+
+	if build, ok := binaryOps[wire.Op]; ok {
+		left, err := child("left", wire.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := child("right", wire.Right)
+		if err != nil {
+			return nil, err
+		}
+		return build(left, right), nil
+	}
+
+	switch wire.Op {
+	case "int":
+		var value int64
+		if err := json.Unmarshal(wire.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: int value: %v", ErrBadExpJSON, err)
+		}
+		return NewIntExp(value), nil
+	case "var":
+		i, err := index()
+		if err != nil {
+			return nil, err
+		}
+		return NewVarExp(i), nil
+	case "assign":
+		i, err := index()
+		if err != nil {
+			return nil, err
+		}
+		value, err := child("value", wire.Value)
+		if err != nil {
+			return nil, err
+		}
+		return NewAssignExp(i, value), nil
+	case "neg":
+		operand, err := child("operand", wire.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return NewNegExp(operand), nil
+	case "if":
+		cond, err := child("cond", wire.Cond)
+		if err != nil {
+			return nil, err
+		}
+		then, err := child("then", wire.Then)
+		if err != nil {
+			return nil, err
+		}
+		els, err := child("else", wire.Else)
+		if err != nil {
+			return nil, err
+		}
+		return NewIfExp(cond, then, els), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrBadExpJSON, wire.Op)
+	}
+}
+
+// unmarshalInto decodes data into the node target points to, which must be
+// of the type the op in data describes.
+func unmarshalInto[T any](data []byte, target *T) error {
+	exp, err := UnmarshalExp(data)
+	if err != nil {
+		return err
+	}
+	node, ok := any(exp).(*T)
+	if !ok {
+		return fmt.Errorf("%w: cannot decode %T into %T", ErrBadExpJSON, exp, target)
+	}
+	*target = *node
+	return nil
+}
+
+func (exp *IntExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonExp{Op: "int", Value: exp.Value})
+}
+
+func (exp *PlusExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonExp{Op: "plus", Left: exp.Left, Right: exp.Right})
+}
+
+func (exp MultExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonExp{Op: "mult", Left: exp.Left, Right: exp.Right})
+}
+
+func (exp DivExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonExp{Op: "div", Left: exp.Left, Right: exp.Right})
+}
+
+func (exp *MinusExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonExp{Op: "minus", Left: exp.Left, Right: exp.Right})
+}
+
+func (exp *NegExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonExp{Op: "neg", Operand: exp.Operand})
+}
+
+func (exp *ModExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonExp{Op: "mod", Left: exp.Left, Right: exp.Right})
+}
+
+func (exp *VarExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonExp{Op: "var", Index: &exp.Index})
+}
+
+func (exp *AssignExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonExp{Op: "assign", Index: &exp.Index, Value: exp.Value})
+}
+
+func (exp *EqExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonExp{Op: "eq", Left: exp.Left, Right: exp.Right})
+}
+
+func (exp *LtExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonExp{Op: "lt", Left: exp.Left, Right: exp.Right})
+}
+
+func (exp *IfExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonExp{Op: "if", Cond: exp.Cond, Then: exp.Then, Else: exp.Else})
+}
+
+func (exp *IntExp) UnmarshalJSON(data []byte) error    { return unmarshalInto(data, exp) }
+func (exp *PlusExp) UnmarshalJSON(data []byte) error   { return unmarshalInto(data, exp) }
+func (exp *MultExp) UnmarshalJSON(data []byte) error   { return unmarshalInto(data, exp) }
+func (exp *DivExp) UnmarshalJSON(data []byte) error    { return unmarshalInto(data, exp) }
+func (exp *MinusExp) UnmarshalJSON(data []byte) error  { return unmarshalInto(data, exp) }
+func (exp *NegExp) UnmarshalJSON(data []byte) error    { return unmarshalInto(data, exp) }
+func (exp *ModExp) UnmarshalJSON(data []byte) error    { return unmarshalInto(data, exp) }
+func (exp *VarExp) UnmarshalJSON(data []byte) error    { return unmarshalInto(data, exp) }
+func (exp *AssignExp) UnmarshalJSON(data []byte) error { return unmarshalInto(data, exp) }
+func (exp *EqExp) UnmarshalJSON(data []byte) error     { return unmarshalInto(data, exp) }
+func (exp *LtExp) UnmarshalJSON(data []byte) error     { return unmarshalInto(data, exp) }
+func (exp *IfExp) UnmarshalJSON(data []byte) error     { return unmarshalInto(data, exp) }
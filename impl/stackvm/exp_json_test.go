@@ -0,0 +1,94 @@
+package stackvm_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"project/impl/stackvm"
+	gen "project/impl/stackvm/generator"
+	"slices"
+	"testing"
+)
+
+func TestMarshalExp(t *testing.T) {
+	exp := stackvm.NewDivExp(stackvm.NewVarExp(1), stackvm.NewNegExp(stackvm.NewIntExp(0)))
+
+	data, err := json.Marshal(exp)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `{"op":"div","left":{"op":"var","index":1},"right":{"op":"neg","operand":{"op":"int","value":0}}}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+}
+
+func TestUnmarshalExp(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "exps", "div_bug.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp, err := stackvm.UnmarshalExp(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := fmt.Sprint(exp); s != "1 / (2 + 1)" {
+		t.Errorf("expected 1 / (2 + 1), got %s", s)
+	}
+
+	// nodes decode into their own type
+	var assign stackvm.AssignExp
+	if err := json.Unmarshal([]byte(`{"op":"assign","index":2,"value":{"op":"int","value":-7}}`), &assign); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := assign.String(); s != "x2 = -7" {
+		t.Errorf("expected x2 = -7, got %s", s)
+	}
+}
+
+func TestUnmarshalExpErrors(t *testing.T) {
+	tests := []string{
+		`[]`,
+		`{"op":"pow","left":{"op":"int","value":2},"right":{"op":"int","value":2}}`,
+		`{"op":"plus","left":{"op":"int","value":2}}`,
+		`{"op":"int","value":1.5}`,
+		`{"op":"var"}`,
+		`{"op":"if","cond":{"op":"int","value":1},"then":null,"else":{"op":"int","value":1}}`,
+	}
+
+	for _, test := range tests {
+		if _, err := stackvm.UnmarshalExp([]byte(test)); !errors.Is(err, stackvm.ErrBadExpJSON) {
+			t.Errorf("%s: expected %v, got %v", test, stackvm.ErrBadExpJSON, err)
+		}
+	}
+
+	var plus stackvm.PlusExp
+	if err := json.Unmarshal([]byte(`{"op":"int","value":1}`), &plus); !errors.Is(err, stackvm.ErrBadExpJSON) {
+		t.Errorf("expected %v decoding an int into a PlusExp, got %v", stackvm.ErrBadExpJSON, err)
+	}
+}
+
+// FuzzExpJSONRoundTrip checks that UnmarshalExp undoes json.Marshal.
+func FuzzExpJSONRoundTrip(f *testing.F) {
+	f.Add(int64(1))
+	f.Add(int64(42))
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		exp := gen.RandomExpWithVars(rand.New(rand.NewSource(seed)), 5, 2)
+		data, err := json.Marshal(exp)
+		if err != nil {
+			t.Fatalf("%s: %v", exp, err)
+		}
+		decoded, err := stackvm.UnmarshalExp(data)
+		if err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+		if !slices.Equal(decoded.Convert(), exp.Convert()) {
+			t.Errorf("%s decodes to %s", exp, decoded)
+		}
+	})
+}
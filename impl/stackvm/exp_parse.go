@@ -0,0 +1,258 @@
+package stackvm
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrUnexpected is reported by ParseExp for a word that does not fit the
+// grammar. The word is empty at the end of the input.
+var ErrUnexpected = errors.New("unexpected")
+
+// ParseExp is the inverse of String and ShowParens. The grammar, from
+// loosest to tightest binding, is
+//
+//	exp     = "if" exp "then" exp "else" exp | var "=" exp | compare
+//	compare = add {("==" | "<") add}
+//	add     = mult {("+" | "-") mult}
+//	mult    = unary {("*" | "/" | "%") unary}
+//	unary   = "-" unary | atom
+//	atom    = int | var | "(" exp ")"
+//
+// Binary operators associate to the left, variables are written x0, x1, ...
+// and a minus directly in front of an integer is part of it, so -5 is an
+// IntExp and -(5) a NegExp. As with String, a / b divides a by b, which is
+// DivExp{Left: b, Right: a}.
+func ParseExp(text string) (Exp, error) {
+	p := &expParser{words: lexExp(text)}
+	exp, err := p.exp()
+	if err != nil {
+		return nil, err
+	}
+	if !p.at("") {
+		return nil, p.unexpected()
+	}
+	return exp, nil
+}
+
+type expParser struct {
+	words []word // the last word is empty and marks the end
+	pos   int
+}
+
+func (p *expParser) peek() word {
+	return p.words[p.pos]
+}
+
+func (p *expParser) at(text string) bool {
+	return p.peek().text == text
+}
+
+func (p *expParser) next() word {
+	w := p.words[p.pos]
+	if p.pos < len(p.words)-1 {
+		p.pos++
+	}
+	return w
+}
+
+func (p *expParser) expect(text string) error {
+	if !p.at(text) {
+		return p.unexpected()
+	}
+	p.next()
+	return nil
+}
+
+func (p *expParser) unexpected() error {
+	return parseError(ErrUnexpected, p.peek())
+}
+
+func (p *expParser) exp() (Exp, error) {
+	if p.at("if") {
+		p.next()
+		cond, err := p.exp()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		then, err := p.exp()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("else"); err != nil {
+			return nil, err
+		}
+		els, err := p.exp()
+		if err != nil {
+			return nil, err
+		}
+		return NewIfExp(cond, then, els), nil
+	}
+
+	if isVariable(p.peek().text) && p.words[p.pos+1].text == "=" {
+		index, err := p.variable()
+		if err != nil {
+			return nil, err
+		}
+		p.next()
+		value, err := p.exp()
+		if err != nil {
+			return nil, err
+		}
+		return NewAssignExp(index, value), nil
+	}
+
+	return p.compare()
+}
+
+// binary parses operands of next joined by the operators in ops.
+func (p *expParser) binary(next func() (Exp, error), ops map[string]func(left, right Exp) Exp) (Exp, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		build, ok := ops[p.peek().text]
+		if !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = build(left, right)
+	}
+}
+
+var (
+	compareOps = map[string]func(left, right Exp) Exp{"==": NewEqExp, "<": NewLtExp}
+	addOps     = map[string]func(left, right Exp) Exp{"+": NewPlusExp, "-": NewMinusExp}
+	multOps    = map[string]func(left, right Exp) Exp{
+		"*": NewMultExp,
+		"/": func(left, right Exp) Exp { return NewDivExp(right, left) },
+		"%": NewModExp,
+	}
+)
+
+func (p *expParser) compare() (Exp, error) {
+	return p.binary(p.add, compareOps)
+}
+
+func (p *expParser) add() (Exp, error) {
+	return p.binary(p.mult, addOps)
+}
+
+func (p *expParser) mult() (Exp, error) {
+	return p.binary(p.unary, multOps)
+}
+
+func (p *expParser) unary() (Exp, error) {
+	if !p.at("-") {
+		return p.atom()
+	}
+	minus := p.next()
+
+	if next := p.peek(); isDigits(next.text) {
+		p.next()
+		value, err := strconv.ParseInt("-"+next.text, 10, 64)
+		if err != nil {
+			return nil, parseError(ErrBadOperand, word{"-" + next.text, minus.line, minus.column})
+		}
+		return NewIntExp(value), nil
+	}
+
+	operand, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return NewNegExp(operand), nil
+}
+
+func (p *expParser) atom() (Exp, error) {
+	w := p.peek()
+	switch {
+	case isDigits(w.text):
+		p.next()
+		value, err := strconv.ParseInt(w.text, 10, 64)
+		if err != nil {
+			return nil, parseError(ErrBadOperand, w)
+		}
+		return NewIntExp(value), nil
+	case isVariable(w.text):
+		index, err := p.variable()
+		if err != nil {
+			return nil, err
+		}
+		return NewVarExp(index), nil
+	case w.text == "(":
+		p.next()
+		exp, err := p.exp()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return exp, nil
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+func (p *expParser) variable() (int64, error) {
+	w := p.next()
+	index, err := strconv.ParseInt(w.text[1:], 10, 64)
+	if err != nil {
+		return 0, parseError(ErrBadOperand, w)
+	}
+	return index, nil
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+func isVariable(s string) bool {
+	return len(s) > 1 && s[0] == 'x' && isDigits(s[1:])
+}
+
+// lexExp splits text into numbers, identifiers, operators and parentheses.
+// Anything else becomes a word of its own that the parser rejects.
+func lexExp(text string) []word {
+	var words []word
+	line, start := 1, 0
+	for i := 0; i < len(text); {
+		c := text[i]
+		column := i - start + 1
+		switch {
+		case c == '\n':
+			line, start = line+1, i+1
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case isWordByte(c):
+			j := i
+			for j < len(text) && isWordByte(text[j]) {
+				j++
+			}
+			words = append(words, word{text[i:j], line, column})
+			i = j
+		case c == '=' && i+1 < len(text) && text[i+1] == '=':
+			words = append(words, word{"==", line, column})
+			i += 2
+		default:
+			words = append(words, word{text[i : i+1], line, column})
+			i++
+		}
+	}
+	return append(words, word{"", line, len(text) - start + 1})
+}
+
+func isWordByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
@@ -0,0 +1,117 @@
+package stackvm_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"project/impl/stackvm"
+	gen "project/impl/stackvm/generator"
+	"slices"
+	"testing"
+)
+
+func TestParseExp(t *testing.T) {
+	x0 := stackvm.NewVarExp(0)
+	n := stackvm.NewIntExp
+
+	tests := []struct {
+		text string
+		exp  stackvm.Exp
+	}{
+		{"1 * (2 + 1)", stackvm.NewMultExp(n(1), stackvm.NewPlusExp(n(2), n(1)))},
+		{"1 + 2 * 3", stackvm.NewPlusExp(n(1), stackvm.NewMultExp(n(2), n(3)))},
+		{"7 - 2 - 1", stackvm.NewMinusExp(stackvm.NewMinusExp(n(7), n(2)), n(1))},
+		{"6 / 3", stackvm.NewDivExp(n(3), n(6))},
+		{"x0 % 3 < 1 == 0", stackvm.NewEqExp(stackvm.NewLtExp(stackvm.NewModExp(x0, n(3)), n(1)), n(0))},
+		{"-5 - -x0", stackvm.NewMinusExp(n(-5), stackvm.NewNegExp(x0))},
+		{"-(5)", stackvm.NewNegExp(n(5))},
+		{"-9223372036854775808", n(-1 << 63)},
+		{"x0 = x0 + 1", stackvm.NewAssignExp(0, stackvm.NewPlusExp(x0, n(1)))},
+		{"if x0 < 0\n  then -x0\n  else x0", stackvm.NewIfExp(stackvm.NewLtExp(x0, n(0)), stackvm.NewNegExp(x0), x0)},
+		{"((x0))", x0},
+	}
+
+	for _, test := range tests {
+		exp, err := stackvm.ParseExp(test.text)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.text, err)
+			continue
+		}
+		if !slices.Equal(exp.Convert(), test.exp.Convert()) {
+			t.Errorf("%q: expected %s, got %s", test.text, stackvm.ShowParens(test.exp), stackvm.ShowParens(exp))
+		}
+	}
+}
+
+func TestParseExpErrors(t *testing.T) {
+	tests := []struct {
+		text         string
+		err          error
+		line, column int
+	}{
+		{"1 +", stackvm.ErrUnexpected, 1, 4},
+		{"(1 + 2", stackvm.ErrUnexpected, 1, 7},
+		{"1 2", stackvm.ErrUnexpected, 1, 3},
+		{"1 +\n  * 2", stackvm.ErrUnexpected, 2, 3},
+		{"if 1 then 2", stackvm.ErrUnexpected, 1, 12},
+		{"y + 1", stackvm.ErrUnexpected, 1, 1},
+		{"1 = 2", stackvm.ErrUnexpected, 1, 3},
+		{"99999999999999999999", stackvm.ErrBadOperand, 1, 1},
+		{"x99999999999999999999", stackvm.ErrBadOperand, 1, 1},
+	}
+
+	for _, test := range tests {
+		_, err := stackvm.ParseExp(test.text)
+		var parseErr *stackvm.ParseError
+		if !errors.As(err, &parseErr) || !errors.Is(err, test.err) {
+			t.Errorf("%q: expected %v, got %v", test.text, test.err, err)
+			continue
+		}
+		if parseErr.Line != test.line || parseErr.Column != test.column {
+			t.Errorf("%q: expected %d:%d, got %d:%d", test.text, test.line, test.column, parseErr.Line, parseErr.Column)
+		}
+	}
+}
+
+// FuzzParseExpRoundTrip checks that ParseExp undoes String and ShowParens on
+// generated expressions.
+func FuzzParseExpRoundTrip(f *testing.F) {
+	f.Add(int64(1))
+	f.Add(int64(42))
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		exp := gen.RandomExpWithVars(rand.New(rand.NewSource(seed)), 5, 2)
+		for _, text := range []string{fmt.Sprint(exp), stackvm.ShowParens(exp)} {
+			parsed, err := stackvm.ParseExp(text)
+			if err != nil {
+				t.Fatalf("%s: %v", text, err)
+			}
+			if !slices.Equal(parsed.Convert(), exp.Convert()) {
+				t.Errorf("%s parses as %s", text, stackvm.ShowParens(parsed))
+			}
+		}
+	})
+}
+
+// FuzzParseExp checks that ParseExp does not panic and that whatever it
+// accepts prints to text it parses to the same tree.
+func FuzzParseExp(f *testing.F) {
+	f.Add("1 * (2 + 1)")
+	f.Add("if x0 < -3 then x1 = -(2) else x0 % 2")
+	f.Add("((1 == 2 - x0)")
+
+	f.Fuzz(func(t *testing.T, text string) {
+		exp, err := stackvm.ParseExp(text)
+		if err != nil {
+			return
+		}
+		printed := stackvm.ShowParens(exp)
+		again, err := stackvm.ParseExp(printed)
+		if err != nil {
+			t.Fatalf("%q parses as %s, which does not parse: %v", text, printed, err)
+		}
+		if !slices.Equal(again.Convert(), exp.Convert()) {
+			t.Errorf("%q parses as %s, which parses as %s", text, printed, stackvm.ShowParens(again))
+		}
+	})
+}
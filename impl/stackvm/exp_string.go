@@ -0,0 +1,133 @@
+package stackvm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Precedence levels of the infix notation, from loosest to tightest. Binary
+// operators associate to the left.
+const (
+	precIf      = iota // if c then a else b, x0 = a
+	precCompare        // == <
+	precAdd            // + -
+	precMult           // * / %
+	precUnary          // -a
+	precAtom           // 7 x0 (a)
+)
+
+// printer renders expressions in infix notation. Unless full is set, it only
+// adds the parentheses precedence and associativity require. It is the
+// Visitor of the node it prints, min the precedence the node must bind at
+// least as tight as to go without parentheses.
+type printer struct {
+	builder strings.Builder
+	full    bool
+	min     int
+}
+
+// ShowParens renders exp like String, but puts every operator in parentheses.
+func ShowParens(exp Exp) string {
+	p := &printer{full: true}
+	p.print(exp, precIf)
+	return p.builder.String()
+}
+
+func showExp(exp Exp) string {
+	p := &printer{}
+	p.print(exp, precIf)
+	return p.builder.String()
+}
+
+// print writes exp in parentheses if it binds looser than min.
+func (p *printer) print(exp Exp, min int) {
+	outer := p.min
+	p.min = min
+	exp.Accept(p)
+	p.min = outer
+}
+
+// wrap calls write for a node of precedence prec and puts its output in
+// parentheses if needed.
+func (p *printer) wrap(prec int, write func()) {
+	parens := prec < p.min || p.full && prec != precAtom
+	if parens {
+		p.builder.WriteString("(")
+	}
+	write()
+	if parens {
+		p.builder.WriteString(")")
+	}
+}
+
+func (p *printer) binary(left Exp, op string, right Exp, prec int) {
+	p.wrap(prec, func() {
+		p.print(left, prec)
+		p.builder.WriteString(op)
+		p.print(right, prec+1)
+	})
+}
+
+func (p *printer) VisitInt(e *IntExp) {
+	p.wrap(precAtom, func() { p.builder.WriteString(strconv.FormatInt(e.Value, 10)) })
+}
+
+func (p *printer) VisitVar(e *VarExp) {
+	p.wrap(precAtom, func() { p.builder.WriteString("x" + strconv.FormatInt(e.Index, 10)) })
+}
+
+func (p *printer) VisitPlus(e *PlusExp) { p.binary(e.Left, " + ", e.Right, precAdd) }
+func (p *printer) VisitMult(e *MultExp) { p.binary(e.Left, " * ", e.Right, precMult) }
+
+// DivExp divides Right by Left
+func (p *printer) VisitDiv(e *DivExp)     { p.binary(e.Right, " / ", e.Left, precMult) }
+func (p *printer) VisitMinus(e *MinusExp) { p.binary(e.Left, " - ", e.Right, precAdd) }
+func (p *printer) VisitMod(e *ModExp)     { p.binary(e.Left, " % ", e.Right, precMult) }
+func (p *printer) VisitEq(e *EqExp)       { p.binary(e.Left, " == ", e.Right, precCompare) }
+func (p *printer) VisitLt(e *LtExp)       { p.binary(e.Left, " < ", e.Right, precCompare) }
+
+func (p *printer) VisitNeg(e *NegExp) {
+	p.wrap(precUnary, func() {
+		p.builder.WriteString("-")
+		switch e.Operand.(type) {
+		case *IntExp, *NegExp:
+			// -(5) is not the literal -5 and -(-a) is not --a
+			p.builder.WriteString("(")
+			p.print(e.Operand, precIf)
+			p.builder.WriteString(")")
+		default:
+			p.print(e.Operand, precUnary)
+		}
+	})
+}
+
+func (p *printer) VisitAssign(e *AssignExp) {
+	p.wrap(precIf, func() {
+		p.builder.WriteString("x" + strconv.FormatInt(e.Index, 10) + " = ")
+		p.print(e.Value, precIf)
+	})
+}
+
+func (p *printer) VisitIf(e *IfExp) {
+	p.wrap(precIf, func() {
+		p.builder.WriteString("if ")
+		p.print(e.Cond, precIf)
+		p.builder.WriteString(" then ")
+		p.print(e.Then, precIf)
+		p.builder.WriteString(" else ")
+		p.print(e.Else, precIf)
+	})
+}
+
+func (exp *IntExp) String() string    { return showExp(exp) }
+func (exp *PlusExp) String() string   { return showExp(exp) }
+func (exp MultExp) String() string    { return showExp(exp) }
+func (exp DivExp) String() string     { return showExp(exp) }
+func (exp *MinusExp) String() string  { return showExp(exp) }
+func (exp *NegExp) String() string    { return showExp(exp) }
+func (exp *ModExp) String() string    { return showExp(exp) }
+func (exp *VarExp) String() string    { return showExp(exp) }
+func (exp *AssignExp) String() string { return showExp(exp) }
+func (exp *EqExp) String() string     { return showExp(exp) }
+func (exp *LtExp) String() string     { return showExp(exp) }
+func (exp *IfExp) String() string     { return showExp(exp) }
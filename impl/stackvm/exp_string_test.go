@@ -0,0 +1,44 @@
+package stackvm_test
+
+import (
+	"fmt"
+	"project/impl/stackvm"
+	"testing"
+)
+
+func TestExpString(t *testing.T) {
+	x0, x1 := stackvm.NewVarExp(0), stackvm.NewVarExp(1)
+	n := stackvm.NewIntExp
+
+	tests := []struct {
+		exp     stackvm.Exp
+		minimal string
+		full    string
+	}{
+		{n(-7), "-7", "-7"},
+		{stackvm.NewDivExp(n(1), stackvm.NewPlusExp(n(2), n(1))), "(2 + 1) / 1", "((2 + 1) / 1)"},
+		{stackvm.NewPlusExp(n(1), stackvm.NewMultExp(n(2), x0)), "1 + 2 * x0", "(1 + (2 * x0))"},
+		{stackvm.NewMinusExp(stackvm.NewMinusExp(x0, x1), n(1)), "x0 - x1 - 1", "((x0 - x1) - 1)"},
+		{stackvm.NewMinusExp(x0, stackvm.NewMinusExp(x1, n(1))), "x0 - (x1 - 1)", "(x0 - (x1 - 1))"},
+		{stackvm.NewPlusExp(x0, stackvm.NewPlusExp(x1, n(1))), "x0 + (x1 + 1)", "(x0 + (x1 + 1))"},
+		{stackvm.NewDivExp(stackvm.NewModExp(x0, n(3)), x1), "x1 / (x0 % 3)", "(x1 / (x0 % 3))"},
+		{stackvm.NewNegExp(n(5)), "-(5)", "(-(5))"},
+		{stackvm.NewNegExp(stackvm.NewNegExp(x0)), "-(-x0)", "(-((-x0)))"},
+		{stackvm.NewNegExp(stackvm.NewPlusExp(x0, n(1))), "-(x0 + 1)", "(-(x0 + 1))"},
+		{stackvm.NewMultExp(stackvm.NewNegExp(x0), n(-2)), "-x0 * -2", "((-x0) * -2)"},
+		{stackvm.NewLtExp(stackvm.NewPlusExp(x0, n(1)), stackvm.NewEqExp(x1, n(0))), "x0 + 1 < (x1 == 0)", "((x0 + 1) < (x1 == 0))"},
+		{stackvm.NewAssignExp(0, stackvm.NewPlusExp(x0, n(1))), "x0 = x0 + 1", "(x0 = (x0 + 1))"},
+		{stackvm.NewPlusExp(stackvm.NewAssignExp(1, n(2)), x1), "(x1 = 2) + x1", "((x1 = 2) + x1)"},
+		{stackvm.NewIfExp(stackvm.NewLtExp(x0, n(0)), stackvm.NewNegExp(x0), x0), "if x0 < 0 then -x0 else x0", "(if (x0 < 0) then (-x0) else x0)"},
+		{stackvm.NewMultExp(stackvm.NewIfExp(x0, n(1), n(2)), n(3)), "(if x0 then 1 else 2) * 3", "((if x0 then 1 else 2) * 3)"},
+	}
+
+	for _, test := range tests {
+		if s := fmt.Sprint(test.exp); s != test.minimal {
+			t.Errorf("expected %s, got %s", test.minimal, s)
+		}
+		if s := stackvm.ShowParens(test.exp); s != test.full {
+			t.Errorf("expected %s, got %s", test.full, s)
+		}
+	}
+}
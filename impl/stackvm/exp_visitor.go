@@ -0,0 +1,109 @@
+package stackvm
+
+// Visitor has a method for every node type, so a pass implementing it is
+// checked by the compiler to handle all of them, unlike a type switch. Accept
+// calls the method for the node it is called on and does not visit children.
+// MultExp and DivExp have value receivers, so their methods get a pointer to
+// a copy of the node whether it is stored as a value or as a pointer.
+type Visitor interface {
+	VisitInt(exp *IntExp)
+	VisitVar(exp *VarExp)
+	VisitAssign(exp *AssignExp)
+	VisitPlus(exp *PlusExp)
+	VisitMult(exp *MultExp)
+	VisitDiv(exp *DivExp)
+	VisitMinus(exp *MinusExp)
+	VisitNeg(exp *NegExp)
+	VisitMod(exp *ModExp)
+	VisitEq(exp *EqExp)
+	VisitLt(exp *LtExp)
+	VisitIf(exp *IfExp)
+}
+
+func (exp *IntExp) Accept(v Visitor)    { v.VisitInt(exp) }
+func (exp *VarExp) Accept(v Visitor)    { v.VisitVar(exp) }
+func (exp *AssignExp) Accept(v Visitor) { v.VisitAssign(exp) }
+func (exp *PlusExp) Accept(v Visitor)   { v.VisitPlus(exp) }
+func (exp MultExp) Accept(v Visitor)    { v.VisitMult(&exp) }
+func (exp DivExp) Accept(v Visitor)     { v.VisitDiv(&exp) }
+func (exp *MinusExp) Accept(v Visitor)  { v.VisitMinus(exp) }
+func (exp *NegExp) Accept(v Visitor)    { v.VisitNeg(exp) }
+func (exp *ModExp) Accept(v Visitor)    { v.VisitMod(exp) }
+func (exp *EqExp) Accept(v Visitor)     { v.VisitEq(exp) }
+func (exp *LtExp) Accept(v Visitor)     { v.VisitLt(exp) }
+func (exp *IfExp) Accept(v Visitor)     { v.VisitIf(exp) }
+
+// Folder combines the results of the children of a node into the result of
+// the node, see Fold. Children are passed in the order of the fields of the
+// node, so the left of a DivExp is its divisor.
+type Folder[T any] interface {
+	Int(exp *IntExp) T
+	Var(exp *VarExp) T
+	Assign(exp *AssignExp, value T) T
+	Plus(exp *PlusExp, left, right T) T
+	Mult(exp *MultExp, left, right T) T
+	Div(exp *DivExp, left, right T) T
+	Minus(exp *MinusExp, left, right T) T
+	Neg(exp *NegExp, operand T) T
+	Mod(exp *ModExp, left, right T) T
+	Eq(exp *EqExp, left, right T) T
+	Lt(exp *LtExp, left, right T) T
+	If(exp *IfExp, cond, then, els T) T
+}
+
+// Fold computes a result for exp bottom up: every child is folded first, from
+// left to right, then the method of f for the node combines their results.
+func Fold[T any](exp Exp, f Folder[T]) T {
+	v := folder[T]{f: f}
+	exp.Accept(&v)
+	return v.result
+}
+
+// folder is the Visitor behind Fold.
+type folder[T any] struct {
+	f      Folder[T]
+	result T
+}
+
+func (v *folder[T]) VisitInt(exp *IntExp) { v.result = v.f.Int(exp) }
+func (v *folder[T]) VisitVar(exp *VarExp) { v.result = v.f.Var(exp) }
+
+func (v *folder[T]) VisitAssign(exp *AssignExp) {
+	v.result = v.f.Assign(exp, Fold(exp.Value, v.f))
+}
+
+func (v *folder[T]) VisitPlus(exp *PlusExp) {
+	v.result = v.f.Plus(exp, Fold(exp.Left, v.f), Fold(exp.Right, v.f))
+}
+
+func (v *folder[T]) VisitMult(exp *MultExp) {
+	v.result = v.f.Mult(exp, Fold(exp.Left, v.f), Fold(exp.Right, v.f))
+}
+
+func (v *folder[T]) VisitDiv(exp *DivExp) {
+	v.result = v.f.Div(exp, Fold(exp.Left, v.f), Fold(exp.Right, v.f))
+}
+
+func (v *folder[T]) VisitMinus(exp *MinusExp) {
+	v.result = v.f.Minus(exp, Fold(exp.Left, v.f), Fold(exp.Right, v.f))
+}
+
+func (v *folder[T]) VisitNeg(exp *NegExp) {
+	v.result = v.f.Neg(exp, Fold(exp.Operand, v.f))
+}
+
+func (v *folder[T]) VisitMod(exp *ModExp) {
+	v.result = v.f.Mod(exp, Fold(exp.Left, v.f), Fold(exp.Right, v.f))
+}
+
+func (v *folder[T]) VisitEq(exp *EqExp) {
+	v.result = v.f.Eq(exp, Fold(exp.Left, v.f), Fold(exp.Right, v.f))
+}
+
+func (v *folder[T]) VisitLt(exp *LtExp) {
+	v.result = v.f.Lt(exp, Fold(exp.Left, v.f), Fold(exp.Right, v.f))
+}
+
+func (v *folder[T]) VisitIf(exp *IfExp) {
+	v.result = v.f.If(exp, Fold(exp.Cond, v.f), Fold(exp.Then, v.f), Fold(exp.Else, v.f))
+}
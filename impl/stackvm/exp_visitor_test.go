@@ -0,0 +1,86 @@
+package stackvm_test
+
+import (
+	"math/rand"
+	"project/impl/stackvm"
+	gen "project/impl/stackvm/generator"
+	"testing"
+)
+
+// rebuild folds an expression into a copy of it.
+type rebuild struct{}
+
+func (rebuild) Int(e *stackvm.IntExp) stackvm.Exp { return stackvm.NewIntExp(e.Value) }
+func (rebuild) Var(e *stackvm.VarExp) stackvm.Exp { return stackvm.NewVarExp(e.Index) }
+
+func (rebuild) Assign(e *stackvm.AssignExp, value stackvm.Exp) stackvm.Exp {
+	return stackvm.NewAssignExp(e.Index, value)
+}
+
+func (rebuild) Plus(_ *stackvm.PlusExp, left, right stackvm.Exp) stackvm.Exp {
+	return stackvm.NewPlusExp(left, right)
+}
+
+func (rebuild) Mult(_ *stackvm.MultExp, left, right stackvm.Exp) stackvm.Exp {
+	return stackvm.NewMultExp(left, right)
+}
+
+func (rebuild) Div(_ *stackvm.DivExp, left, right stackvm.Exp) stackvm.Exp {
+	return stackvm.NewDivExp(left, right)
+}
+
+func (rebuild) Minus(_ *stackvm.MinusExp, left, right stackvm.Exp) stackvm.Exp {
+	return stackvm.NewMinusExp(left, right)
+}
+
+func (rebuild) Neg(_ *stackvm.NegExp, operand stackvm.Exp) stackvm.Exp {
+	return stackvm.NewNegExp(operand)
+}
+
+func (rebuild) Mod(_ *stackvm.ModExp, left, right stackvm.Exp) stackvm.Exp {
+	return stackvm.NewModExp(left, right)
+}
+
+func (rebuild) Eq(_ *stackvm.EqExp, left, right stackvm.Exp) stackvm.Exp {
+	return stackvm.NewEqExp(left, right)
+}
+
+func (rebuild) Lt(_ *stackvm.LtExp, left, right stackvm.Exp) stackvm.Exp {
+	return stackvm.NewLtExp(left, right)
+}
+
+func (rebuild) If(_ *stackvm.IfExp, cond, then, els stackvm.Exp) stackvm.Exp {
+	return stackvm.NewIfExp(cond, then, els)
+}
+
+func TestFold(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for range 100 {
+		exp := gen.RandomExpWithVars(rand, 4, 2)
+		if copied := stackvm.Fold[stackvm.Exp](exp, rebuild{}); stackvm.ShowParens(copied) != stackvm.ShowParens(exp) {
+			t.Errorf("expected %s, got %s", stackvm.ShowParens(exp), stackvm.ShowParens(copied))
+		}
+	}
+}
+
+// divisors records the divisor of every DivExp it visits.
+type divisors struct {
+	stackvm.Visitor // panics for the other nodes
+	found           []stackvm.Exp
+}
+
+func (d *divisors) VisitDiv(e *stackvm.DivExp) {
+	d.found = append(d.found, e.Left)
+}
+
+func TestAcceptValueReceivers(t *testing.T) {
+	// DivExp nodes are visited whether stored as a value or as a pointer
+	two := stackvm.NewIntExp(2)
+	for _, exp := range []stackvm.Exp{stackvm.DivExp{Left: two, Right: two}, &stackvm.DivExp{Left: two, Right: two}} {
+		var d divisors
+		exp.Accept(&d)
+		if len(d.found) != 1 || d.found[0] != two {
+			t.Errorf("%#v: expected divisor 2, got %v", exp, d.found)
+		}
+	}
+}
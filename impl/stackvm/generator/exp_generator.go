@@ -7,44 +7,137 @@ import (
 )
 
 func randomIntExp(rand *rand.Rand) stackvm.Exp {
-	value := rand.Intn(2) + 1
-	return stackvm.NewIntExp(value)
+	switch rand.Intn(4) {
+	case 0:
+		return stackvm.NewIntExp(0)
+	case 1:
+		// small values, including negatives
+		return stackvm.NewIntExp(rand.Int63n(21) - 10)
+	case 2:
+		// large values, beyond what a float64 can represent exactly
+		value := rand.Int63()
+		if rand.Intn(2) == 0 {
+			value = -value
+		}
+		return stackvm.NewIntExp(value)
+	default:
+		return stackvm.NewIntExp(rand.Int63n(2) + 1)
+	}
+}
+
+func randomLeafExp(rand *rand.Rand, vars int) stackvm.Exp {
+	if vars > 0 && rand.Intn(2) == 0 {
+		return stackvm.NewVarExp(rand.Int63n(int64(vars)))
+	}
+	return randomIntExp(rand)
 }
 
-func randomPlusExp(rand *rand.Rand, depth int) stackvm.Exp {
-	left := RandomExp(rand, depth-1)
-	right := RandomExp(rand, depth-1)
+func randomPlusExp(rand *rand.Rand, depth int, vars int) stackvm.Exp {
+	left := randomExp(rand, depth-1, vars)
+	right := randomExp(rand, depth-1, vars)
 	return stackvm.NewPlusExp(left, right)
 }
 
-func randomMultExp(rand *rand.Rand, depth int) stackvm.Exp {
-	left := RandomExp(rand, depth-1)
-	right := RandomExp(rand, depth-1)
+func randomMultExp(rand *rand.Rand, depth int, vars int) stackvm.Exp {
+	left := randomExp(rand, depth-1, vars)
+	right := randomExp(rand, depth-1, vars)
 	return stackvm.NewMultExp(left, right)
 }
 
-func randomDivExp(rand *rand.Rand, depth int) stackvm.Exp {
-	left := RandomExp(rand, depth-1)
-	right := RandomExp(rand, depth-1)
+func randomDivExp(rand *rand.Rand, depth int, vars int) stackvm.Exp {
+	left := randomExp(rand, depth-1, vars)
+	right := randomExp(rand, depth-1, vars)
 	return stackvm.NewDivExp(left, right)
 }
 
+func randomMinusExp(rand *rand.Rand, depth int, vars int) stackvm.Exp {
+	left := randomExp(rand, depth-1, vars)
+	right := randomExp(rand, depth-1, vars)
+	return stackvm.NewMinusExp(left, right)
+}
+
+func randomNegExp(rand *rand.Rand, depth int, vars int) stackvm.Exp {
+	operand := randomExp(rand, depth-1, vars)
+	return stackvm.NewNegExp(operand)
+}
+
+func randomModExp(rand *rand.Rand, depth int, vars int) stackvm.Exp {
+	left := randomExp(rand, depth-1, vars)
+	right := randomExp(rand, depth-1, vars)
+	return stackvm.NewModExp(left, right)
+}
+
+func randomEqExp(rand *rand.Rand, depth int, vars int) stackvm.Exp {
+	left := randomExp(rand, depth-1, vars)
+	right := randomExp(rand, depth-1, vars)
+	return stackvm.NewEqExp(left, right)
+}
+
+func randomLtExp(rand *rand.Rand, depth int, vars int) stackvm.Exp {
+	left := randomExp(rand, depth-1, vars)
+	right := randomExp(rand, depth-1, vars)
+	return stackvm.NewLtExp(left, right)
+}
+
+func randomIfExp(rand *rand.Rand, depth int, vars int) stackvm.Exp {
+	cond := randomExp(rand, depth-1, vars)
+	then := randomExp(rand, depth-1, vars)
+	els := randomExp(rand, depth-1, vars)
+	return stackvm.NewIfExp(cond, then, els)
+}
+
+func randomAssignExp(rand *rand.Rand, depth int, vars int) stackvm.Exp {
+	index := rand.Int63n(int64(vars))
+	value := randomExp(rand, depth-1, vars)
+	return stackvm.NewAssignExp(index, value)
+}
+
+// RandomExp generates an expression without variables of at most the given depth.
 func RandomExp(rand *rand.Rand, depth int) stackvm.Exp {
+	return randomExp(rand, depth, 0)
+}
+
+// RandomExpWithVars generates an expression of at most the given depth that
+// reads and assigns the variables x0 ... x<vars-1>.
+func RandomExpWithVars(rand *rand.Rand, depth int, vars int) stackvm.Exp {
+	return randomExp(rand, depth, vars)
+}
+
+func randomExp(rand *rand.Rand, depth int, vars int) stackvm.Exp {
 	if depth <= 0 {
-		return randomIntExp(rand)
+		return randomLeafExp(rand, vars)
+	}
+
+	operators := 10
+	if vars > 0 {
+		operators = 11
 	}
 
-	operator := rand.Intn(4)
+	operator := rand.Intn(operators)
 	switch operator {
 	case 0:
-		return randomIntExp(rand)
+		return randomLeafExp(rand, vars)
 	case 1:
-		return randomPlusExp(rand, depth)
+		return randomPlusExp(rand, depth, vars)
 	case 2:
-		return randomMultExp(rand, depth)
+		return randomMultExp(rand, depth, vars)
 	case 3:
-		return randomDivExp(rand, depth)
+		return randomDivExp(rand, depth, vars)
+	case 4:
+		return randomMinusExp(rand, depth, vars)
+	case 5:
+		return randomNegExp(rand, depth, vars)
+	case 6:
+		return randomModExp(rand, depth, vars)
+	case 7:
+		return randomEqExp(rand, depth, vars)
+	case 8:
+		return randomLtExp(rand, depth, vars)
+	case 9:
+		return randomIfExp(rand, depth, vars)
+	case 10:
+		return randomAssignExp(rand, depth, vars)
 	default:
-		return randomIntExp(rand)
+		return randomLeafExp(rand, vars)
 	}
 }
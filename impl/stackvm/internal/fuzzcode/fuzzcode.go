@@ -0,0 +1,34 @@
+// Package fuzzcode turns fuzzer input into stack programs, so fuzz targets
+// over arbitrary token streams share one encoding and their seeds mean the
+// same program everywhere.
+package fuzzcode
+
+import "project/impl/stackvm"
+
+// Decode maps every byte to a token. Bytes below 128 become the tokens 0 to
+// 15, every opcode and the unknown 15, the others the tokens -128 to -1,
+// which are operands of jumps going back or unknown opcodes.
+func Decode(data []byte) []stackvm.Token {
+	code := make([]stackvm.Token, len(data))
+	for i, b := range data {
+		code[i] = stackvm.Token(int8(b))
+		if code[i] >= 0 {
+			code[i] %= 16
+		}
+	}
+	return code
+}
+
+// DecodeStraight maps every byte to one of the tokens 0 to 15 like Decode
+// maps the bytes below 128, but turns jumps into the unknown opcode 15. The
+// programs cannot loop and every operand indexes an Env of 16 variables.
+func DecodeStraight(data []byte) []stackvm.Token {
+	code := make([]stackvm.Token, len(data))
+	for i, b := range data {
+		code[i] = stackvm.Token(b % 16)
+		if code[i] == stackvm.Jmp || code[i] == stackvm.JmpIfZero {
+			code[i] = 15
+		}
+	}
+	return code
+}
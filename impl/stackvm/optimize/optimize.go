@@ -0,0 +1,299 @@
+// Package optimize rewrites stack programs into shorter programs that compute
+// the same result.
+package optimize
+
+import (
+	"math"
+
+	"project/impl/stackvm"
+)
+
+// end is the target of jumps to the end of the program.
+const end = -1
+
+// instruction is a decoded instruction. Jumps refer to the id of their
+// target, so instructions can be removed without fixing offsets by hand.
+type instruction struct {
+	id      int
+	op      stackvm.Token
+	operand stackvm.Token // Push, Load and Store
+	target  int           // id of the target of Jmp and JmpIfZero, or end
+}
+
+// Optimize returns a program that computes the same result as code in fewer
+// instructions. It folds constants, drops identities like x 1 * and x 1 /,
+// resolves jumps on constant conditions and removes unreachable code.
+//
+// Folding only happens where the result is pushed exactly as the VM computes
+// it, so results stay bit for bit the same. Programs that stackvm.Verify
+// rejects are returned unchanged, as their faults would move.
+func Optimize(code []stackvm.Token) []stackvm.Token {
+	if stackvm.Verify(code) != nil {
+		return code
+	}
+
+	instrs := decode(code)
+	for changed := true; changed; {
+		var rewritten, removed bool
+		instrs, rewritten = peephole(instrs)
+		instrs, removed = removeUnreachable(instrs)
+		changed = rewritten || removed
+	}
+	return encode(instrs)
+}
+
+func decode(code []stackvm.Token) []instruction {
+	// ids are the indices of the instructions in code
+	var instrs []instruction
+	for pc := 0; pc < len(code); pc++ {
+		if stackvm.HasOperand(code[pc]) && pc+1 == len(code) {
+			// unreachable, Verify checked the others
+			break
+		}
+		instr := instruction{id: pc, op: code[pc]}
+		switch instr.op {
+		case stackvm.Jmp, stackvm.JmpIfZero:
+			instr.target = pc + 2 + int(code[pc+1])
+			if instr.target == len(code) {
+				instr.target = end
+			}
+		case stackvm.Push, stackvm.Load, stackvm.Store:
+			instr.operand = code[pc+1]
+		}
+		if stackvm.HasOperand(instr.op) {
+			pc++
+		}
+		instrs = append(instrs, instr)
+	}
+	return instrs
+}
+
+func encode(instrs []instruction) []stackvm.Token {
+	// jumps can be encoded once the position of every instruction is known
+	positions := map[int]int{}
+	pc := 0
+	for _, instr := range instrs {
+		positions[instr.id] = pc
+		pc++
+		if stackvm.HasOperand(instr.op) {
+			pc++
+		}
+	}
+	positions[end] = pc
+
+	code := make([]stackvm.Token, 0, pc)
+	for _, instr := range instrs {
+		switch instr.op {
+		case stackvm.Jmp, stackvm.JmpIfZero:
+			offset := positions[instr.target] - (len(code) + 2)
+			code = append(code, instr.op, stackvm.Token(offset))
+		case stackvm.Push:
+			// prefer the short forms of 1 and 2
+			switch instr.operand {
+			case 1:
+				code = append(code, stackvm.One)
+			case 2:
+				code = append(code, stackvm.Two)
+			default:
+				code = append(code, stackvm.Push, instr.operand)
+			}
+		case stackvm.Load, stackvm.Store:
+			code = append(code, instr.op, instr.operand)
+		default:
+			code = append(code, instr.op)
+		}
+	}
+	return code
+}
+
+// constant returns the instruction that pushes value. value must be exact.
+func constant(id int, value float64) instruction {
+	switch value {
+	case 1:
+		return instruction{id: id, op: stackvm.One}
+	case 2:
+		return instruction{id: id, op: stackvm.Two}
+	default:
+		return instruction{id: id, op: stackvm.Push, operand: stackvm.Token(value)}
+	}
+}
+
+// value reports what a constant instruction pushes.
+func value(instr instruction) (float64, bool) {
+	switch instr.op {
+	case stackvm.One:
+		return 1, true
+	case stackvm.Two:
+		return 2, true
+	case stackvm.Push:
+		return float64(instr.operand), true
+	default:
+		return 0, false
+	}
+}
+
+// exact reports whether Push can produce v. Negative zero cannot be pushed.
+func exact(v float64) bool {
+	return v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 && !(v == 0 && math.Signbit(v))
+}
+
+// fold computes a binary instruction the way the VM does.
+func fold(op stackvm.Token, left, right float64) (float64, bool) {
+	switch op {
+	case stackvm.Plus:
+		return left + right, true
+	case stackvm.Mult:
+		return left * right, true
+	case stackvm.Div:
+		return left / right, true
+	case stackvm.Minus:
+		return left - right, true
+	case stackvm.Mod:
+		return math.Mod(left, right), true
+	case stackvm.Eq:
+		return boolToFloat(left == right), true
+	case stackvm.Lt:
+		return boolToFloat(left < right), true
+	default:
+		return 0, false
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// peephole applies one round of rewrites to windows of instructions. Only
+// the first instruction of a window may be a jump target, so no path enters
+// the middle of a rewritten window.
+func peephole(instrs []instruction) ([]instruction, bool) {
+	targets := map[int]bool{}
+	for _, instr := range instrs {
+		if instr.op == stackvm.Jmp || instr.op == stackvm.JmpIfZero {
+			targets[instr.target] = true
+		}
+	}
+	// windows that are replaced by nothing pass their jump targets on
+	forward := map[int]int{}
+
+	var out []instruction
+	changed := false
+	for i := 0; i < len(instrs); i++ {
+		instr := instrs[i]
+		next := end
+		if i+1 < len(instrs) {
+			next = instrs[i+1].id
+		}
+		a, aConst := value(instr)
+
+		// c1 c2 op => c
+		if aConst && i+2 < len(instrs) && !targets[instrs[i+1].id] && !targets[instrs[i+2].id] {
+			if b, bConst := value(instrs[i+1]); bConst {
+				if result, ok := fold(instrs[i+2].op, a, b); ok && exact(result) {
+					out = append(out, constant(instr.id, result))
+					i += 2
+					changed = true
+					continue
+				}
+			}
+		}
+
+		if i+1 < len(instrs) && !targets[next] {
+			op := instrs[i+1].op
+			after := end
+			if i+2 < len(instrs) {
+				after = instrs[i+2].id
+			}
+
+			switch {
+			// c neg => -c
+			case aConst && op == stackvm.Neg && exact(-a):
+				out = append(out, constant(instr.id, -a))
+				i++
+				changed = true
+				continue
+			// 1 * and 1 / leave the value below unchanged, as does 0 -
+			case aConst && (a == 1 && (op == stackvm.Mult || op == stackvm.Div) || a == 0 && op == stackvm.Minus),
+				instr.op == stackvm.Neg && op == stackvm.Neg:
+				forward[instr.id] = after
+				i++
+				changed = true
+				continue
+			// a constant condition either never jumps or always does
+			case aConst && op == stackvm.JmpIfZero:
+				if a == 0 {
+					out = append(out, instruction{id: instr.id, op: stackvm.Jmp, target: instrs[i+1].target})
+				} else {
+					forward[instr.id] = after
+				}
+				i++
+				changed = true
+				continue
+			}
+		}
+
+		// jmp 0 => nothing
+		if instr.op == stackvm.Jmp && instr.target == next {
+			forward[instr.id] = next
+			changed = true
+			continue
+		}
+
+		out = append(out, instr)
+	}
+
+	for i := range out {
+		if out[i].op == stackvm.Jmp || out[i].op == stackvm.JmpIfZero {
+			out[i].target = resolve(forward, out[i].target)
+		}
+	}
+	return out, changed
+}
+
+// resolve follows forwarded targets until it reaches one that was kept.
+func resolve(forward map[int]int, target int) int {
+	for {
+		next, ok := forward[target]
+		if !ok {
+			return target
+		}
+		target = next
+	}
+}
+
+// removeUnreachable drops instructions no path from the start reaches.
+func removeUnreachable(instrs []instruction) ([]instruction, bool) {
+	index := map[int]int{end: len(instrs)}
+	for i, instr := range instrs {
+		index[instr.id] = i
+	}
+
+	reached := make([]bool, len(instrs)+1)
+	pending := []int{0}
+	for len(pending) > 0 {
+		i := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for i < len(instrs) && !reached[i] {
+			reached[i] = true
+			switch instrs[i].op {
+			case stackvm.Jmp:
+				i = index[instrs[i].target]
+				continue
+			case stackvm.JmpIfZero:
+				pending = append(pending, index[instrs[i].target])
+			}
+			i++
+		}
+	}
+
+	var out []instruction
+	for i, instr := range instrs {
+		if reached[i] {
+			out = append(out, instr)
+		}
+	}
+	return out, len(out) != len(instrs)
+}
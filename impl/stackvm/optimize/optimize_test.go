@@ -0,0 +1,110 @@
+package optimize
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"project/impl/stackvm"
+	"project/impl/stackvm/generator"
+	"project/impl/stackvm/internal/fuzzcode"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		code      string
+		optimized string
+	}{
+		{"1 2 + ", "3 "},
+		{"2 3 * 4 - ", "2 "},
+		{"x0 1 * ", "x0 "},
+		{"x0 1 / 0 - ", "x0 "},
+		{"x0 neg neg ", "x0 "},
+		{"5 neg ", "-5 "},
+		{"push 1 x0 + ", "1 x0 + "},
+		// results the VM cannot push stay unfolded
+		{"1 2 / ", "1 2 / "},
+		{"0 neg ", "0 neg "},
+		{"1 0 / ", "1 0 / "},
+		// if 1 < 2 then x0 else x1
+		{"1 2 < jz 4 x0 jmp 2 x1 ", "x0 "},
+		{"x0 jz 5 1 2 + jmp 2 x1 ", "x0 jz 4 3 jmp 2 x1 "},
+		// jumps into a window keep it apart
+		{"x0 x0 jz 1 neg neg ", "x0 x0 jz 1 neg neg "},
+		{"x0 x0 jz 1 neg 1 * ", "x0 x0 jz 1 neg "},
+		// invalid programs are not touched
+		{"1 2 + + ", "1 2 + + "},
+	}
+
+	for _, test := range tests {
+		code, err := stackvm.Parse(test.code)
+		if err != nil {
+			t.Fatalf("%s: %v", test.code, err)
+		}
+		if optimized := stackvm.Show(Optimize(code)); optimized != test.optimized {
+			t.Errorf("%s: expected %s, got %s", test.code, test.optimized, optimized)
+		}
+	}
+}
+
+// sameRun reports whether two runs yield the same result, fault and
+// variables. NaN results compare equal.
+func sameRun(t *testing.T, code, optimized []stackvm.Token, env stackvm.Env) {
+	t.Helper()
+	envOptimized := slices.Clone(env)
+	expected, expectedErr := stackvm.NewVM(code).RunWith(env)
+	result, err := stackvm.NewVM(optimized).RunWith(envOptimized)
+
+	if !errors.Is(err, errors.Unwrap(expectedErr)) {
+		t.Fatalf("%s optimized to %s: expected fault %v, got %v", stackvm.Show(code), stackvm.Show(optimized), expectedErr, err)
+	}
+	if result != expected && !(math.IsNaN(result) && math.IsNaN(expected)) {
+		t.Errorf("%s optimized to %s: expected %g, got %g", stackvm.Show(code), stackvm.Show(optimized), expected, result)
+	}
+	for i := range env {
+		if env[i] != envOptimized[i] && !(math.IsNaN(env[i]) && math.IsNaN(envOptimized[i])) {
+			t.Errorf("%s optimized to %s: expected x%d = %g, got %g", stackvm.Show(code), stackvm.Show(optimized), i, env[i], envOptimized[i])
+		}
+	}
+}
+
+// FuzzOptimize differential-tests Optimize against the VM on generated
+// expressions.
+func FuzzOptimize(f *testing.F) {
+	f.Add(int64(1), 3.0, -2.0)
+	f.Add(int64(2), 0.0, 1.0)
+	f.Add(int64(7), math.Inf(1), math.NaN())
+
+	f.Fuzz(func(t *testing.T, seed int64, x0, x1 float64) {
+		exp := generator.RandomExpWithVars(rand.New(rand.NewSource(seed)), 5, 2)
+		code := exp.Convert()
+		optimized := Optimize(code)
+		if len(optimized) > len(code) {
+			t.Errorf("%s grew to %s", stackvm.Show(code), stackvm.Show(optimized))
+		}
+		sameRun(t, code, optimized, stackvm.Env{x0, x1})
+	})
+}
+
+// FuzzOptimizeTokens differential-tests Optimize on arbitrary programs with
+// jumps.
+func FuzzOptimizeTokens(f *testing.F) {
+	f.Add([]byte{3, 14, 3, 4, 13, 1, 3})
+	f.Add([]byte{5, 0, 14, 4, 9, 0, 13, 1, 4, 3, 2})
+	f.Add([]byte{9, 0, 3, 2, 3, 1})
+	// unreachable load without operand at the end
+	f.Add([]byte{9, 0, 14, 0, 9, 0, 13, 1, 9})
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		code := fuzzcode.Decode(in)
+		if stackvm.Verify(code) != nil {
+			return
+		}
+		if _, err := stackvm.NewVM(code, stackvm.WithMaxSteps(1000)).RunWith(make(stackvm.Env, 16)); errors.Is(err, stackvm.ErrOutOfGas) {
+			return
+		}
+		sameRun(t, code, Optimize(code), make(stackvm.Env, 16))
+	})
+}
@@ -0,0 +1,146 @@
+package stackvm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Faults reported by Parse. They are wrapped in a *ParseError.
+var (
+	ErrUnknownInstruction = errors.New("unknown instruction")
+	ErrBadOperand         = errors.New("invalid operand")
+)
+
+// ParseError describes the word of the text Parse or ParseExp rejected. Line
+// and Column count from 1, columns in bytes. Word is empty at the end of the
+// text.
+type ParseError struct {
+	Err    error
+	Line   int
+	Column int
+	Word   string
+}
+
+func (e *ParseError) Error() string {
+	if e.Word == "" {
+		return fmt.Sprintf("line %d, column %d: %v end of input", e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("line %d, column %d: %v %q", e.Line, e.Column, e.Err, e.Word)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// mnemonics maps the names Show prints to their opcodes.
+var mnemonics = map[string]Token{
+	"+":     Plus,
+	"*":     Mult,
+	"/":     Div,
+	"1":     One,
+	"2":     Two,
+	"push":  Push,
+	"-":     Minus,
+	"neg":   Neg,
+	"%":     Mod,
+	"load":  Load,
+	"store": Store,
+	"==":    Eq,
+	"<":     Lt,
+	"jmp":   Jmp,
+	"jz":    JmpIfZero,
+}
+
+type word struct {
+	text         string
+	line, column int
+}
+
+// Parse is the inverse of Show, Parse(Show(code)) yields code. Instructions
+// are separated by any whitespace and # starts a comment that runs to the end
+// of the line. Besides the words Show prints
+//
+//	7          push 7, 1 and 2 use One and Two
+//	push 7     push 7, also for 1 and 2
+//	x3 =x3     load and store variable 3, also written load 3 and store 3
+//	jmp -4     jump, likewise jz
+//	Unknown(9) the opcode 9
+//
+// An instruction at the very end may lack its operand, like Show prints it.
+func Parse(text string) ([]Token, error) {
+	words := splitWords(text)
+	code := make([]Token, 0, len(words))
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+
+		if op, ok := mnemonics[w.text]; ok {
+			code = append(code, op)
+			if !HasOperand(op) || i+1 == len(words) {
+				continue
+			}
+			i++
+			operand, err := strconv.ParseInt(words[i].text, 10, 64)
+			if err != nil {
+				return nil, parseError(ErrBadOperand, words[i])
+			}
+			code = append(code, Token(operand))
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(w.text, "=x"):
+			index, err := strconv.ParseInt(w.text[2:], 10, 64)
+			if err != nil {
+				return nil, parseError(ErrBadOperand, w)
+			}
+			code = append(code, Store, Token(index))
+		case strings.HasPrefix(w.text, "x"):
+			index, err := strconv.ParseInt(w.text[1:], 10, 64)
+			if err != nil {
+				return nil, parseError(ErrBadOperand, w)
+			}
+			code = append(code, Load, Token(index))
+		case strings.HasPrefix(w.text, "Unknown(") && strings.HasSuffix(w.text, ")"):
+			op, err := strconv.ParseInt(w.text[len("Unknown("):len(w.text)-1], 10, 64)
+			if err != nil {
+				return nil, parseError(ErrBadOperand, w)
+			}
+			code = append(code, Token(op))
+		default:
+			value, err := strconv.ParseInt(w.text, 10, 64)
+			if err != nil {
+				return nil, parseError(ErrUnknownInstruction, w)
+			}
+			code = append(code, Push, Token(value))
+		}
+	}
+	return code, nil
+}
+
+func parseError(err error, w word) *ParseError {
+	return &ParseError{Err: err, Line: w.line, Column: w.column, Word: w.text}
+}
+
+// splitWords splits text at whitespace and drops comments.
+func splitWords(text string) []word {
+	var words []word
+	for n, line := range strings.Split(text, "\n") {
+		if comment := strings.IndexByte(line, '#'); comment >= 0 {
+			line = line[:comment]
+		}
+		start := -1
+		for i := 0; i <= len(line); i++ {
+			space := i == len(line) || strings.IndexByte(" \t\r\v\f", line[i]) >= 0
+			switch {
+			case space && start >= 0:
+				words = append(words, word{line[start:i], n + 1, start + 1})
+				start = -1
+			case !space && start < 0:
+				start = i
+			}
+		}
+	}
+	return words
+}
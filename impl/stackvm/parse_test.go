@@ -0,0 +1,110 @@
+package stackvm_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"project/impl/stackvm"
+	"project/impl/stackvm/internal/fuzzcode"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		code []stackvm.Token
+	}{
+		{"1 2 + ", []stackvm.Token{stackvm.One, stackvm.Two, stackvm.Plus}},
+		{"push 1 push 2 -7 ", []stackvm.Token{stackvm.Push, 1, stackvm.Push, 2, stackvm.Push, -7}},
+		{"x1 =x0 load 2 store 3", []stackvm.Token{stackvm.Load, 1, stackvm.Store, 0, stackvm.Load, 2, stackvm.Store, 3}},
+		{"\t1\n\n  jz 1 # comment\r\n2 # 3 +", []stackvm.Token{stackvm.One, stackvm.JmpIfZero, 1, stackvm.Two}},
+		{"Unknown(42) Unknown(-1)", []stackvm.Token{42, -1}},
+		{"1 push", []stackvm.Token{stackvm.One, stackvm.Push}},
+		{"# nothing", []stackvm.Token{}},
+	}
+
+	for _, test := range tests {
+		code, err := stackvm.Parse(test.text)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.text, err)
+			continue
+		}
+		if !slices.Equal(code, test.code) {
+			t.Errorf("%q: expected %v, got %v", test.text, test.code, code)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		text         string
+		err          error
+		line, column int
+	}{
+		{"1 2 ?", stackvm.ErrUnknownInstruction, 1, 5},
+		{"1\n  2 +\n\tjz x", stackvm.ErrBadOperand, 3, 5},
+		{"# x0\nxy", stackvm.ErrBadOperand, 2, 1},
+		{"Unknown()", stackvm.ErrBadOperand, 1, 1},
+	}
+
+	for _, test := range tests {
+		_, err := stackvm.Parse(test.text)
+		var parseErr *stackvm.ParseError
+		if !errors.As(err, &parseErr) || !errors.Is(err, test.err) {
+			t.Errorf("%q: expected %v, got %v", test.text, test.err, err)
+			continue
+		}
+		if parseErr.Line != test.line || parseErr.Column != test.column {
+			t.Errorf("%q: expected %d:%d, got %d:%d", test.text, test.line, test.column, parseErr.Line, parseErr.Column)
+		}
+	}
+}
+
+func TestParsePrograms(t *testing.T) {
+	tests := []struct {
+		file   string
+		env    stackvm.Env
+		result float64
+	}{
+		{"abs.stack", stackvm.Env{-3}, 3},
+		{"abs.stack", stackvm.Env{5}, 5},
+	}
+
+	for _, test := range tests {
+		text, err := os.ReadFile(filepath.Join("testdata", "programs", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := stackvm.Parse(string(text))
+		if err != nil {
+			t.Fatalf("%s: %v", test.file, err)
+		}
+		result, err := stackvm.NewVM(code).RunWith(test.env)
+		if err != nil || result != test.result {
+			t.Errorf("%s with %v: expected %g, got %g, %v", test.file, test.env, test.result, result, err)
+		}
+	}
+}
+
+// FuzzParseRoundTrip checks Parse(Show(code)) == code for arbitrary tokens.
+func FuzzParseRoundTrip(f *testing.F) {
+	f.Add([]byte{3, 4, 0})
+	f.Add([]byte{5, 1, 5, 2, 5, 3})
+	f.Add([]byte{9, 0, 10, 200, 42})
+	f.Add([]byte{14, 3, 13})
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		code := fuzzcode.Decode(in)
+
+		text := stackvm.Show(code)
+		parsed, err := stackvm.Parse(text)
+		if err != nil {
+			t.Fatalf("%s: %v", text, err)
+		}
+		if !slices.Equal(parsed, code) {
+			t.Errorf("%v shows as %q, parses as %v", code, strings.TrimSpace(text), parsed)
+		}
+	})
+}
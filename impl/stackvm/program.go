@@ -0,0 +1,108 @@
+package stackvm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Faults reported by Program.UnmarshalBinary and LoadVM.
+var (
+	ErrBadMagic           = errors.New("not a stack program")
+	ErrUnsupportedVersion = errors.New("unsupported format version")
+	ErrCorruptProgram     = errors.New("corrupt program")
+	ErrBadChecksum        = errors.New("checksum mismatch")
+)
+
+// The binary format of a Program is
+//
+//	magic    4 bytes "SVM\x00"
+//	version  1 byte
+//	count    uvarint, number of tokens
+//	tokens   count varints
+//	checksum 4 bytes big endian CRC-32 (IEEE) of everything before it
+const (
+	programMagic   = "SVM\x00"
+	programVersion = 1
+)
+
+// Program wraps the tokens of a program for storage outside of Go, e.g. to
+// keep programs the fuzzer found.
+type Program struct {
+	Code []Token
+}
+
+func (p Program) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, len(programMagic)+1+binary.MaxVarintLen64+2*len(p.Code)+crc32.Size)
+	data = append(data, programMagic...)
+	data = append(data, programVersion)
+	data = binary.AppendUvarint(data, uint64(len(p.Code)))
+	for _, token := range p.Code {
+		data = binary.AppendVarint(data, int64(token))
+	}
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data)), nil
+}
+
+// UnmarshalBinary decodes a program MarshalBinary produced. It reports
+// ErrBadMagic, ErrUnsupportedVersion, ErrCorruptProgram or ErrBadChecksum,
+// the program is left untouched then.
+func (p *Program) UnmarshalBinary(data []byte) error {
+	header := len(programMagic) + 1
+	if len(data) < header+crc32.Size || string(data[:len(programMagic)]) != programMagic {
+		return ErrBadMagic
+	}
+	if version := data[len(programMagic)]; version != programVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	body, checksum := data[:len(data)-crc32.Size], data[len(data)-crc32.Size:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(checksum) {
+		return ErrBadChecksum
+	}
+
+	rest := body[header:]
+	count, n := binary.Uvarint(rest)
+	// every token takes at least one byte
+	if !canonical(rest, n) || count > uint64(len(rest)-n) {
+		return fmt.Errorf("%w: bad token count", ErrCorruptProgram)
+	}
+	rest = rest[n:]
+
+	code := make([]Token, count)
+	for i := range code {
+		token, n := binary.Varint(rest)
+		if !canonical(rest, n) {
+			return fmt.Errorf("%w: bad token %d", ErrCorruptProgram, i)
+		}
+		code[i] = Token(token)
+		rest = rest[n:]
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("%w: %d bytes after the last token", ErrCorruptProgram, len(rest))
+	}
+
+	p.Code = code
+	return nil
+}
+
+// canonical reports whether the varint of n bytes at the start of data was
+// decoded and is as short as possible, so every program has one encoding.
+func canonical(data []byte, n int) bool {
+	return n == 1 || n > 1 && data[n-1] != 0
+}
+
+// LoadVM reads a program in the format of Program.MarshalBinary from r and
+// creates a VM for it.
+func LoadVM(r io.Reader, opts ...Option) (*VM, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var p Program
+	if err := p.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return NewVM(p.Code, opts...), nil
+}
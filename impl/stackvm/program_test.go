@@ -0,0 +1,95 @@
+package stackvm_test
+
+import (
+	"bytes"
+	"errors"
+	"project/impl/stackvm"
+	"slices"
+	"testing"
+)
+
+func TestProgramRoundTrip(t *testing.T) {
+	code := []stackvm.Token{stackvm.Load, 0, stackvm.Push, -1 << 40, stackvm.Lt, stackvm.JmpIfZero, 2, stackvm.Two, stackvm.Neg, 99}
+
+	data, err := stackvm.Program{Code: code}.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var p stackvm.Program
+	if err := p.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(p.Code, code) {
+		t.Errorf("expected %v, got %v", code, p.Code)
+	}
+}
+
+func TestProgramErrors(t *testing.T) {
+	data, _ := stackvm.Program{Code: []stackvm.Token{stackvm.One, stackvm.Two, stackvm.Plus}}.MarshalBinary()
+	corrupt := func(i int, b byte) []byte {
+		c := slices.Clone(data)
+		c[i] = b
+		return c
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, stackvm.ErrBadMagic},
+		{"magic", corrupt(0, 'X'), stackvm.ErrBadMagic},
+		{"version", corrupt(4, 2), stackvm.ErrUnsupportedVersion},
+		{"checksum", corrupt(6, byte(stackvm.Mult)), stackvm.ErrBadChecksum},
+		{"truncated", data[:len(data)-1], stackvm.ErrBadChecksum},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := stackvm.Program{Code: []stackvm.Token{stackvm.One}}
+			err := p.UnmarshalBinary(test.data)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if len(p.Code) != 1 {
+				t.Errorf("failed decoding changed the program to %v", p.Code)
+			}
+		})
+	}
+}
+
+func TestLoadVM(t *testing.T) {
+	data, _ := stackvm.Program{Code: []stackvm.Token{stackvm.Load, 0, stackvm.Two, stackvm.Mult}}.MarshalBinary()
+
+	vm, err := stackvm.LoadVM(bytes.NewReader(data), stackvm.WithMaxSteps(10))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result, err := vm.RunWith(stackvm.Env{21}); err != nil || result != 42 {
+		t.Errorf("expected 42, got %g, %v", result, err)
+	}
+
+	if _, err := stackvm.LoadVM(bytes.NewReader(data[1:])); !errors.Is(err, stackvm.ErrBadMagic) {
+		t.Errorf("expected %v, got %v", stackvm.ErrBadMagic, err)
+	}
+}
+
+// FuzzUnmarshalProgram checks that decoding never panics and that accepted
+// input is exactly what MarshalBinary produces for the decoded program.
+func FuzzUnmarshalProgram(f *testing.F) {
+	for _, code := range [][]stackvm.Token{{}, {stackvm.One}, {stackvm.Push, -300, stackvm.Neg}} {
+		data, _ := stackvm.Program{Code: code}.MarshalBinary()
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p stackvm.Program
+		if err := p.UnmarshalBinary(data); err != nil {
+			return
+		}
+		again, _ := p.MarshalBinary()
+		if !bytes.Equal(again, data) {
+			t.Errorf("%x decodes to %v, which encodes to %x", data, p.Code, again)
+		}
+	})
+}
@@ -0,0 +1,254 @@
+// Package regvm runs stack programs on registers instead of a stack. It
+// shares no run-time code with stackvm.VM, so running both on the same
+// program gives an independent oracle for differential testing.
+//
+// A program is compiled into three-address code once. The stack depth at
+// every instruction is known statically, so the stack slot d becomes the
+// register rd and every stack instruction becomes exactly one register
+// instruction:
+//
+//	1 x0 + 2 /   =>   r0 = 1; r1 = x0; r0 = r0 + r1; r1 = 2; r0 = r0 / r1
+package regvm
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"project/impl/stackvm"
+)
+
+type opcode int
+
+const (
+	opConst opcode = iota // dst = value
+	opLoad                // dst = x[index]
+	opStore               // x[index] = a
+	opAdd                 // dst = a + b
+	opSub                 // dst = a - b
+	opMul                 // dst = a * b
+	opDiv                 // dst = a / b
+	opMod                 // dst = a % b
+	opEq                  // dst = a == b
+	opLt                  // dst = a < b
+	opNeg                 // dst = -a
+	opJmp                 // goto target
+	opJz                  // if a == 0 goto target
+)
+
+// instr is a three-address instruction. pc is the index of the stack
+// instruction it was compiled from, depth the stack depth before it.
+type instr struct {
+	op        opcode
+	dst, a, b int
+	value     float64
+	index     int64
+	target    int
+	pc        int
+	depth     int
+}
+
+// VM runs a compiled program. Its Run, TryRun and RunWith behave like those
+// of stackvm.VM and report faults as *stackvm.RunError.
+type VM struct {
+	codes     []stackvm.Token
+	instrs    []instr
+	registers int
+	maxSteps  int // 0 means unlimited
+}
+
+// Option configures a VM created by NewVM.
+type Option func(*VM)
+
+// WithMaxSteps stops a run with stackvm.ErrOutOfGas once n instructions have
+// been executed, like stackvm.WithMaxSteps.
+func WithMaxSteps(n int) Option {
+	return func(vm *VM) {
+		vm.maxSteps = n
+	}
+}
+
+// NewVM compiles codes. Registers are assigned from the stack depth at every
+// instruction, which only programs stackvm.Verify accepts have, so unlike
+// stackvm.NewVM, which reports faults once the program runs, NewVM rejects the
+// other programs with the error of Verify, like stackvm.CompileWith does.
+func NewVM(codes []stackvm.Token, opts ...Option) (*VM, error) {
+	depths, err := stackvm.StackDepths(codes)
+	if err != nil {
+		return nil, err
+	}
+
+	vm := &VM{codes: codes}
+	for _, opt := range opts {
+		opt(vm)
+	}
+
+	// unreachable instructions are left out, so jump targets are renumbered
+	index := make([]int, len(codes)+1)
+	for pc := range codes {
+		index[pc] = len(vm.instrs)
+		if depths[pc] < 0 {
+			continue
+		}
+		vm.instrs = append(vm.instrs, compile(codes, pc, depths[pc]))
+		vm.registers = max(vm.registers, depths[pc]+1)
+	}
+	index[len(codes)] = len(vm.instrs)
+	for i := range vm.instrs {
+		if vm.instrs[i].op == opJmp || vm.instrs[i].op == opJz {
+			vm.instrs[i].target = index[vm.instrs[i].target]
+		}
+	}
+	return vm, nil
+}
+
+// binaryOps maps the stack instructions that replace the two topmost values
+// by one.
+var binaryOps = map[stackvm.Token]opcode{
+	stackvm.Plus:  opAdd,
+	stackvm.Minus: opSub,
+	stackvm.Mult:  opMul,
+	stackvm.Div:   opDiv,
+	stackvm.Mod:   opMod,
+	stackvm.Eq:    opEq,
+	stackvm.Lt:    opLt,
+}
+
+var symbols = map[opcode]string{opAdd: "+", opSub: "-", opMul: "*", opDiv: "/", opMod: "%", opEq: "==", opLt: "<"}
+
+// compile translates the instruction at pc, which runs with depth values on
+// the stack. Jump targets are left as pcs.
+func compile(codes []stackvm.Token, pc int, depth int) instr {
+	top, below := depth-1, depth-2
+	in := instr{pc: pc, depth: depth}
+	switch op := codes[pc]; op {
+	case stackvm.One:
+		in.op, in.dst, in.value = opConst, depth, 1
+	case stackvm.Two:
+		in.op, in.dst, in.value = opConst, depth, 2
+	case stackvm.Push:
+		in.op, in.dst, in.value = opConst, depth, float64(codes[pc+1])
+	case stackvm.Load:
+		in.op, in.dst, in.index = opLoad, depth, int64(codes[pc+1])
+	case stackvm.Store:
+		in.op, in.a, in.index = opStore, top, int64(codes[pc+1])
+	case stackvm.Neg:
+		in.op, in.dst, in.a = opNeg, top, top
+	case stackvm.Jmp:
+		in.op, in.target = opJmp, pc+2+int(codes[pc+1])
+	case stackvm.JmpIfZero:
+		in.op, in.a, in.target = opJz, top, pc+2+int(codes[pc+1])
+	default:
+		in.op, in.dst, in.a, in.b = binaryOps[op], below, below, top
+	}
+	return in
+}
+
+// Run executes the program and panics if it faults.
+func (vm *VM) Run() float64 {
+	result, err := vm.TryRun()
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// TryRun executes the program without variables.
+func (vm *VM) TryRun() (float64, error) {
+	return vm.RunWith(nil)
+}
+
+// RunWith executes the program with variables bound to env. Compiled
+// programs can only fault by reading or assigning an unbound variable or by
+// running out of steps.
+func (vm *VM) RunWith(env stackvm.Env) (float64, error) {
+	r := make([]float64, vm.registers)
+	steps := 0
+	for ip := 0; ip < len(vm.instrs); {
+		in := &vm.instrs[ip]
+		if vm.maxSteps > 0 && steps >= vm.maxSteps {
+			return 0, vm.fault(stackvm.ErrOutOfGas, in, r, steps)
+		}
+		ip++
+
+		switch in.op {
+		case opConst:
+			r[in.dst] = in.value
+		case opLoad:
+			if in.index < 0 || in.index >= int64(len(env)) {
+				return 0, vm.fault(stackvm.ErrUnboundVariable, in, r, steps)
+			}
+			r[in.dst] = env[in.index]
+		case opStore:
+			if in.index < 0 || in.index >= int64(len(env)) {
+				return 0, vm.fault(stackvm.ErrUnboundVariable, in, r, steps)
+			}
+			env[in.index] = r[in.a]
+		case opAdd:
+			r[in.dst] = r[in.a] + r[in.b]
+		case opSub:
+			r[in.dst] = r[in.a] - r[in.b]
+		case opMul:
+			r[in.dst] = r[in.a] * r[in.b]
+		case opDiv:
+			r[in.dst] = r[in.a] / r[in.b]
+		case opMod:
+			r[in.dst] = math.Mod(r[in.a], r[in.b])
+		case opEq:
+			r[in.dst] = boolToFloat(r[in.a] == r[in.b])
+		case opLt:
+			r[in.dst] = boolToFloat(r[in.a] < r[in.b])
+		case opNeg:
+			r[in.dst] = -r[in.a]
+		case opJmp:
+			ip = in.target
+		case opJz:
+			if r[in.a] == 0 {
+				ip = in.target
+			}
+		}
+		steps++
+	}
+	// Verify guarantees a single value at the end
+	return r[0], nil
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// fault reports the registers that hold the stack as the stack.
+func (vm *VM) fault(err error, in *instr, r []float64, steps int) *stackvm.RunError {
+	stack := make([]float64, in.depth)
+	copy(stack, r)
+	return &stackvm.RunError{Err: err, PC: in.pc, Op: vm.codes[in.pc], Steps: steps, Stack: stack}
+}
+
+// String lists the compiled program, one instruction per line.
+func (vm *VM) String() string {
+	var builder strings.Builder
+	for i, in := range vm.instrs {
+		fmt.Fprintf(&builder, "%4d | ", i)
+		switch in.op {
+		case opConst:
+			fmt.Fprintf(&builder, "r%d = %g", in.dst, in.value)
+		case opLoad:
+			fmt.Fprintf(&builder, "r%d = x%d", in.dst, in.index)
+		case opStore:
+			fmt.Fprintf(&builder, "x%d = r%d", in.index, in.a)
+		case opNeg:
+			fmt.Fprintf(&builder, "r%d = -r%d", in.dst, in.a)
+		case opJmp:
+			fmt.Fprintf(&builder, "goto %d", in.target)
+		case opJz:
+			fmt.Fprintf(&builder, "if r%d == 0 goto %d", in.a, in.target)
+		default:
+			fmt.Fprintf(&builder, "r%d = r%d %s r%d", in.dst, in.a, symbols[in.op], in.b)
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
@@ -0,0 +1,131 @@
+package regvm
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"project/impl/stackvm"
+	"project/impl/stackvm/generator"
+	"project/impl/stackvm/internal/fuzzcode"
+)
+
+func TestRegisterVM(t *testing.T) {
+	// 1 x0 + 2 /
+	code := []stackvm.Token{stackvm.One, stackvm.Load, 0, stackvm.Plus, stackvm.Two, stackvm.Div}
+	vm, err := NewVM(code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	listing := "   0 | r0 = 1\n   1 | r1 = x0\n   2 | r0 = r0 + r1\n   3 | r1 = 2\n   4 | r0 = r0 / r1\n"
+	if vm.String() != listing {
+		t.Errorf("expected\n%s\ngot\n%s", listing, vm.String())
+	}
+	if result, err := vm.RunWith(stackvm.Env{5}); err != nil || result != 3 {
+		t.Errorf("expected 3, got %g, %v", result, err)
+	}
+}
+
+func TestRegisterVMJumps(t *testing.T) {
+	// if x0 < 0 then -x0 else x0, with dead code after the jump
+	code, _ := stackvm.Parse("x0 0 < jz 6 x0 neg jmp 3 Unknown(99) x0")
+	vm, err := NewVM(code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, x := range []float64{-3, 4} {
+		if result, err := vm.RunWith(stackvm.Env{x}); err != nil || result != math.Abs(x) {
+			t.Errorf("x0 = %g: expected %g, got %g, %v", x, math.Abs(x), result, err)
+		}
+	}
+}
+
+func TestRegisterVMFaults(t *testing.T) {
+	if _, err := NewVM([]stackvm.Token{stackvm.One, stackvm.Plus}); !errors.Is(err, stackvm.ErrStackUnderflow) {
+		t.Errorf("expected %v, got %v", stackvm.ErrStackUnderflow, err)
+	}
+
+	vm, _ := NewVM([]stackvm.Token{stackvm.One, stackvm.Load, 3, stackvm.Plus})
+	_, err := vm.TryRun()
+	var runErr *stackvm.RunError
+	if !errors.As(err, &runErr) || !errors.Is(err, stackvm.ErrUnboundVariable) {
+		t.Fatalf("expected %v, got %v", stackvm.ErrUnboundVariable, err)
+	}
+	if runErr.PC != 1 || !slices.Equal(runErr.Stack, []float64{1}) {
+		t.Errorf("expected fault at pc 1 with stack [1], got %v", runErr)
+	}
+
+	// an endless loop
+	vm, _ = NewVM([]stackvm.Token{stackvm.One, stackvm.Load, 0, stackvm.JmpIfZero, -4}, WithMaxSteps(10))
+	if _, err := vm.RunWith(stackvm.Env{0}); !errors.Is(err, stackvm.ErrOutOfGas) {
+		t.Errorf("expected %v, got %v", stackvm.ErrOutOfGas, err)
+	}
+}
+
+// same treats NaN as equal to itself.
+func same(a, b float64) bool {
+	return a == b || math.IsNaN(a) && math.IsNaN(b)
+}
+
+// sameRun compares a run of the stack VM with a run of the register VM,
+// including faults and assigned variables.
+func sameRun(t *testing.T, code []stackvm.Token, env stackvm.Env) {
+	t.Helper()
+	vm, err := NewVM(code, WithMaxSteps(1000))
+	if err != nil {
+		t.Fatalf("%s: %v", stackvm.Show(code), err)
+	}
+
+	envStack, envRegister := slices.Clone(env), slices.Clone(env)
+	expected, expectedErr := stackvm.NewVM(code, stackvm.WithMaxSteps(1000)).RunWith(envStack)
+	result, err := vm.RunWith(envRegister)
+
+	if expectedErr != nil || err != nil {
+		var expectedRunErr, runErr *stackvm.RunError
+		if !errors.As(expectedErr, &expectedRunErr) || !errors.As(err, &runErr) ||
+			expectedRunErr.Err != runErr.Err || expectedRunErr.PC != runErr.PC || expectedRunErr.Steps != runErr.Steps ||
+			!slices.EqualFunc(expectedRunErr.Stack, runErr.Stack, same) {
+			t.Fatalf("%s: stack VM reports %v, register VM reports %v\n%s", stackvm.Show(code), expectedErr, err, vm)
+		}
+		return
+	}
+	if !same(result, expected) {
+		t.Errorf("%s: stack VM yields %g, register VM yields %g\n%s", stackvm.Show(code), expected, result, vm)
+	}
+	for i := range env {
+		if !same(envStack[i], envRegister[i]) {
+			t.Errorf("%s: stack VM assigns x%d = %g, register VM %g\n%s", stackvm.Show(code), i, envStack[i], envRegister[i], vm)
+		}
+	}
+}
+
+// FuzzRegisterVM runs generated expressions on both backends.
+func FuzzRegisterVM(f *testing.F) {
+	f.Add(int64(1), 3.0, -2.0)
+	f.Add(int64(2), 0.0, math.NaN())
+
+	f.Fuzz(func(t *testing.T, seed int64, x0, x1 float64) {
+		exp := generator.RandomExpWithVars(rand.New(rand.NewSource(seed)), 5, 2)
+		sameRun(t, exp.Convert(), stackvm.Env{x0, x1})
+	})
+}
+
+// FuzzRegisterVMTokens runs arbitrary verified programs on both backends.
+func FuzzRegisterVMTokens(f *testing.F) {
+	f.Add([]byte{3, 14, 3, 4, 13, 1, 3})
+	f.Add([]byte{9, 0, 3, 12, 14, 251, 9, 0})
+	f.Add([]byte{9, 20, 10, 1, 3, 2})
+	// 0/0 on the stack of a fault
+	f.Add([]byte{9, 0, 9, 0, 9, 0, 2, 10, 199, 0})
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		code := fuzzcode.Decode(in)
+		if stackvm.Verify(code) != nil {
+			return
+		}
+		sameRun(t, code, make(stackvm.Env, 16))
+	})
+}
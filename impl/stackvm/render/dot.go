@@ -0,0 +1,41 @@
+package render
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"project/impl/stackvm"
+)
+
+// DOT renders exp as a Graphviz digraph. Edges are labelled with the field
+// that holds the child.
+func DOT(exp stackvm.Exp, opts ...Option) string {
+	c := newConfig(opts)
+	var builder strings.Builder
+	builder.WriteString("digraph exp {\n")
+	builder.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+
+	id := 0
+	var walk func(exp stackvm.Exp) int
+	walk = func(exp stackvm.Exp) int {
+		node := id
+		id++
+		text, edges := label(exp)
+		fmt.Fprintf(&builder, "\tn%d [label=%s", node, strconv.Quote(text))
+		if c.highlight(exp) {
+			builder.WriteString(", style=filled, fillcolor=\"#f4cccc\", color=\"#cc0000\"")
+		}
+		builder.WriteString("];\n")
+
+		for _, e := range edges {
+			child := walk(e.child)
+			fmt.Fprintf(&builder, "\tn%d -> n%d [label=%s];\n", node, child, strconv.Quote(e.field))
+		}
+		return node
+	}
+	walk(exp)
+
+	builder.WriteString("}\n")
+	return builder.String()
+}
@@ -0,0 +1,93 @@
+// Package render draws expression trees as Graphviz DOT or as SVG, e.g. to
+// attach a picture of a minimized mismatch to a bug report.
+package render
+
+import (
+	"strconv"
+
+	"project/impl/stackvm"
+)
+
+// Option configures DOT and SVG.
+type Option func(*config)
+
+type config struct {
+	highlight func(stackvm.Exp) bool
+}
+
+// Highlight marks every node for which match returns true.
+func Highlight(match func(stackvm.Exp) bool) Option {
+	return func(c *config) {
+		c.highlight = match
+	}
+}
+
+// DivBug matches the DivExp nodes whose Left is not an *IntExp, which
+// DivExp.Eval evaluates to 0.
+func DivBug(exp stackvm.Exp) bool {
+	var left stackvm.Exp
+	switch e := exp.(type) {
+	case *stackvm.DivExp:
+		left = e.Left
+	case stackvm.DivExp:
+		left = e.Left
+	default:
+		return false
+	}
+	_, ok := left.(*stackvm.IntExp)
+	return !ok
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{highlight: func(stackvm.Exp) bool { return false }}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// edge connects a node to the child in one of its fields.
+type edge struct {
+	field string
+	child stackvm.Exp
+}
+
+// label is the text of a node, children are drawn below it.
+func label(exp stackvm.Exp) (string, []edge) {
+	var l labeler
+	exp.Accept(&l)
+	return l.text, l.edges
+}
+
+// labeler is the Visitor behind label.
+type labeler struct {
+	text  string
+	edges []edge
+}
+
+func (l *labeler) binary(text string, left, right stackvm.Exp) {
+	l.text, l.edges = text, []edge{{"left", left}, {"right", right}}
+}
+
+func (l *labeler) VisitInt(e *stackvm.IntExp) { l.text = strconv.FormatInt(e.Value, 10) }
+func (l *labeler) VisitVar(e *stackvm.VarExp) { l.text = "x" + strconv.FormatInt(e.Index, 10) }
+
+func (l *labeler) VisitAssign(e *stackvm.AssignExp) {
+	l.text, l.edges = "x"+strconv.FormatInt(e.Index, 10)+" =", []edge{{"value", e.Value}}
+}
+
+func (l *labeler) VisitPlus(e *stackvm.PlusExp)   { l.binary("+", e.Left, e.Right) }
+func (l *labeler) VisitMult(e *stackvm.MultExp)   { l.binary("*", e.Left, e.Right) }
+func (l *labeler) VisitDiv(e *stackvm.DivExp)     { l.binary("/", e.Left, e.Right) }
+func (l *labeler) VisitMinus(e *stackvm.MinusExp) { l.binary("-", e.Left, e.Right) }
+func (l *labeler) VisitMod(e *stackvm.ModExp)     { l.binary("%", e.Left, e.Right) }
+func (l *labeler) VisitEq(e *stackvm.EqExp)       { l.binary("==", e.Left, e.Right) }
+func (l *labeler) VisitLt(e *stackvm.LtExp)       { l.binary("<", e.Left, e.Right) }
+
+func (l *labeler) VisitNeg(e *stackvm.NegExp) {
+	l.text, l.edges = "neg", []edge{{"operand", e.Operand}}
+}
+
+func (l *labeler) VisitIf(e *stackvm.IfExp) {
+	l.text, l.edges = "if", []edge{{"cond", e.Cond}, {"then", e.Then}, {"else", e.Else}}
+}
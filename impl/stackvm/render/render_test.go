@@ -0,0 +1,135 @@
+package render
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"project/impl/stackvm"
+	"project/impl/stackvm/generator"
+)
+
+func TestDOT(t *testing.T) {
+	// 1 / (2 + 1)
+	exp := stackvm.NewDivExp(stackvm.NewPlusExp(stackvm.NewIntExp(2), stackvm.NewIntExp(1)), stackvm.NewIntExp(1))
+
+	expected := `digraph exp {
+	node [shape=box, fontname="monospace"];
+	n0 [label="/", style=filled, fillcolor="#f4cccc", color="#cc0000"];
+	n1 [label="+"];
+	n2 [label="2"];
+	n1 -> n2 [label="left"];
+	n3 [label="1"];
+	n1 -> n3 [label="right"];
+	n0 -> n1 [label="left"];
+	n4 [label="1"];
+	n0 -> n4 [label="right"];
+}
+`
+	if dot := DOT(exp, Highlight(DivBug)); dot != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, dot)
+	}
+	if dot := DOT(exp); strings.Contains(dot, "filled") {
+		t.Errorf("expected no highlighting without the option, got\n%s", dot)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	exp := stackvm.NewIfExp(
+		stackvm.NewLtExp(stackvm.NewVarExp(0), stackvm.NewIntExp(0)),
+		stackvm.NewDivExp(stackvm.NewNegExp(stackvm.NewVarExp(0)), stackvm.NewIntExp(3)),
+		stackvm.NewAssignExp(1, stackvm.NewIntExp(-7)))
+
+	svg := SVG(exp, Highlight(DivBug))
+	rects, texts := countElements(t, svg)
+	if rects != 10 || texts != 10+9 {
+		t.Errorf("expected 10 nodes and 9 edge labels, got %d rects and %d texts\n%s", rects, texts, svg)
+	}
+	if strings.Count(svg, "#f4cccc") != 1 {
+		t.Errorf("expected one highlighted node\n%s", svg)
+	}
+	if !strings.Contains(svg, ">x1 =<") || !strings.Contains(svg, ">&lt;<") {
+		t.Errorf("expected escaped labels\n%s", svg)
+	}
+}
+
+// countElements parses svg as XML and counts its rect and text elements.
+func countElements(t *testing.T, svg string) (rects, texts int) {
+	t.Helper()
+	decoder := xml.NewDecoder(strings.NewReader(svg))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return rects, texts
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %v\n%s", err, svg)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			switch start.Name.Local {
+			case "rect":
+				rects++
+			case "text":
+				texts++
+			}
+		}
+	}
+}
+
+// checkLayout parses svg and reports rects outside the viewBox and rects in
+// the same row that overlap.
+func checkLayout(t *testing.T, svg string) {
+	t.Helper()
+	var image struct {
+		ViewBox string `xml:"viewBox,attr"`
+		Rects   []struct {
+			X      int `xml:"x,attr"`
+			Y      int `xml:"y,attr"`
+			Width  int `xml:"width,attr"`
+			Height int `xml:"height,attr"`
+		} `xml:"rect"`
+	}
+	if err := xml.Unmarshal([]byte(svg), &image); err != nil {
+		t.Fatalf("invalid SVG: %v\n%s", err, svg)
+	}
+	var minX, minY, width, height int
+	if _, err := fmt.Sscanf(image.ViewBox, "%d %d %d %d", &minX, &minY, &width, &height); err != nil {
+		t.Fatalf("invalid viewBox %q: %v", image.ViewBox, err)
+	}
+
+	for i, r := range image.Rects {
+		if r.X < minX || r.Y < minY || r.X+r.Width > minX+width || r.Y+r.Height > minY+height {
+			t.Errorf("rect at (%d, %d) of width %d lies outside the viewBox %s\n%s", r.X, r.Y, r.Width, image.ViewBox, svg)
+		}
+		for _, other := range image.Rects[:i] {
+			if other.Y == r.Y && r.X < other.X+other.Width && other.X < r.X+r.Width {
+				t.Errorf("rects at x %d and %d overlap in row %d\n%s", other.X, r.X, r.Y, svg)
+			}
+		}
+	}
+}
+
+func TestSVGLayout(t *testing.T) {
+	for _, exp := range []stackvm.Exp{
+		stackvm.NewAssignExp(0, stackvm.NewIntExp(1)),
+		stackvm.NewPlusExp(stackvm.NewAssignExp(1000000, stackvm.NewIntExp(1)), stackvm.NewIntExp(2)),
+		stackvm.NewNegExp(stackvm.NewNegExp(stackvm.NewIntExp(-1234567890123))),
+		stackvm.NewIfExp(stackvm.NewIntExp(1), stackvm.NewAssignExp(123456789, stackvm.NewVarExp(987654321)), stackvm.NewIntExp(2)),
+	} {
+		checkLayout(t, SVG(exp))
+	}
+}
+
+func FuzzSVG(f *testing.F) {
+	f.Add(int64(1))
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		exp := generator.RandomExpWithVars(rand.New(rand.NewSource(seed)), 4, 2)
+		svg := SVG(exp, Highlight(DivBug))
+		countElements(t, svg)
+		checkLayout(t, svg)
+	})
+}
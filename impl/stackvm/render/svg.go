@@ -0,0 +1,121 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"project/impl/stackvm"
+)
+
+// Sizes of the SVG layout in pixels.
+const (
+	charWidth  = 8
+	nodeHeight = 24
+	nodePad    = 12 // horizontal space around the text of a node
+	gap        = 10 // horizontal space between neighbouring leaves
+	rowHeight  = 64
+	margin     = 10
+)
+
+// box is a laid out node. x and y are the center of its top edge.
+type box struct {
+	exp      stackvm.Exp
+	text     string
+	x, y     int
+	width    int
+	children []*box
+	fields   []string
+}
+
+// layout gives every subtree a slot as wide as the wider of its node and its
+// children, and places slots of siblings from left to right. A node is
+// centered above its children and its children are centered below it, so no
+// two boxes in a row overlap.
+type layout struct {
+	height int
+}
+
+// place lays out the subtree of exp in the slot starting at left and returns
+// its root and the width of the slot.
+func (l *layout) place(exp stackvm.Exp, depth int, left int) (*box, int) {
+	text, edges := label(exp)
+	b := &box{exp: exp, text: text, y: margin + depth*rowHeight, width: len(text)*charWidth + 2*nodePad}
+	if b.y+nodeHeight+margin > l.height {
+		l.height = b.y + nodeHeight + margin
+	}
+
+	if len(edges) == 0 {
+		b.x = left + b.width/2
+		return b, b.width
+	}
+
+	span := -gap
+	for _, e := range edges {
+		child, width := l.place(e.child, depth+1, left+span+gap)
+		b.children = append(b.children, child)
+		b.fields = append(b.fields, e.field)
+		span += gap + width
+	}
+	slot := max(span, b.width)
+	if shift := (slot - span) / 2; shift > 0 {
+		for _, child := range b.children {
+			child.shift(shift)
+		}
+	}
+
+	// above the middle of its children, as far as the slot allows
+	center := (b.children[0].x + b.children[len(b.children)-1].x) / 2
+	b.x = min(max(center, left+b.width/2), left+slot-b.width/2)
+	return b, slot
+}
+
+// shift moves b and its subtree dx to the right.
+func (b *box) shift(dx int) {
+	b.x += dx
+	for _, child := range b.children {
+		child.shift(dx)
+	}
+}
+
+// SVG renders exp as a self-contained SVG image of its tree. Edges are
+// labelled with the field that holds the child.
+func SVG(exp stackvm.Exp, opts ...Option) string {
+	c := newConfig(opts)
+	l := &layout{}
+	root, slot := l.place(exp, 0, margin)
+	width := slot + 2*margin
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"monospace\" font-size=\"13\">\n", width, l.height, width, l.height)
+
+	// edges first, so nodes are drawn on top of them
+	var edges func(b *box)
+	edges = func(b *box) {
+		for i, child := range b.children {
+			fmt.Fprintf(&builder, "  <line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"#666666\"/>\n", b.x, b.y+nodeHeight, child.x, child.y)
+			fmt.Fprintf(&builder, "  <text x=\"%d\" y=\"%d\" text-anchor=\"middle\" font-size=\"10\" fill=\"#666666\">%s</text>\n",
+				(b.x+child.x)/2, (b.y+nodeHeight+child.y)/2, b.fields[i])
+			edges(child)
+		}
+	}
+	edges(root)
+
+	var nodes func(b *box)
+	nodes = func(b *box) {
+		fill, stroke := "#ffffff", "#000000"
+		if c.highlight(b.exp) {
+			fill, stroke = "#f4cccc", "#cc0000"
+		}
+		fmt.Fprintf(&builder, "  <rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"4\" fill=\"%s\" stroke=\"%s\"/>\n",
+			b.x-b.width/2, b.y, b.width, nodeHeight, fill, stroke)
+		fmt.Fprintf(&builder, "  <text x=\"%d\" y=\"%d\" text-anchor=\"middle\">%s</text>\n", b.x, b.y+nodeHeight/2+4, html.EscapeString(b.text))
+		for _, child := range b.children {
+			nodes(child)
+		}
+	}
+	nodes(root)
+
+	builder.WriteString("</svg>\n")
+	return builder.String()
+}
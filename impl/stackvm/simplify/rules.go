@@ -0,0 +1,133 @@
+package simplify
+
+import (
+	"math"
+
+	"project/impl/stackvm"
+)
+
+// FoldConstants replaces an operator applied to integers by its value, if an
+// IntExp can hold that value exactly.
+func FoldConstants(exp stackvm.Exp) (stackvm.Exp, bool) {
+	var operands []stackvm.Exp
+	switch e := exp.(type) {
+	case *stackvm.PlusExp:
+		operands = []stackvm.Exp{e.Left, e.Right}
+	case *stackvm.MultExp:
+		operands = []stackvm.Exp{e.Left, e.Right}
+	case *stackvm.DivExp:
+		operands = []stackvm.Exp{e.Left, e.Right}
+	case *stackvm.MinusExp:
+		operands = []stackvm.Exp{e.Left, e.Right}
+	case *stackvm.NegExp:
+		operands = []stackvm.Exp{e.Operand}
+	case *stackvm.ModExp:
+		operands = []stackvm.Exp{e.Left, e.Right}
+	case *stackvm.EqExp:
+		operands = []stackvm.Exp{e.Left, e.Right}
+	case *stackvm.LtExp:
+		operands = []stackvm.Exp{e.Left, e.Right}
+	default:
+		return nil, false
+	}
+	for _, operand := range operands {
+		if _, ok := operand.(*stackvm.IntExp); !ok {
+			return nil, false
+		}
+	}
+
+	// constants do not read variables
+	value := exp.Eval(nil)
+	if value != math.Trunc(value) || value < math.MinInt64 || value >= math.MaxInt64 || value == 0 && math.Signbit(value) {
+		return nil, false
+	}
+	return stackvm.NewIntExp(int64(value)), true
+}
+
+// PruneIf replaces an IfExp with a constant condition by the branch it takes.
+func PruneIf(exp stackvm.Exp) (stackvm.Exp, bool) {
+	e, ok := exp.(*stackvm.IfExp)
+	if !ok {
+		return nil, false
+	}
+	cond, ok := e.Cond.(*stackvm.IntExp)
+	if !ok {
+		return nil, false
+	}
+	if cond.Value != 0 {
+		return e.Then, true
+	}
+	return e.Else, true
+}
+
+// MultOne rewrites x * 1 and 1 * x to x.
+func MultOne(exp stackvm.Exp) (stackvm.Exp, bool) {
+	e, ok := exp.(*stackvm.MultExp)
+	if !ok {
+		return nil, false
+	}
+	switch {
+	case isInt(e.Right, 1):
+		return e.Left, true
+	case isInt(e.Left, 1):
+		return e.Right, true
+	default:
+		return nil, false
+	}
+}
+
+// DivOne rewrites x / 1 to x. The divisor of a DivExp is its Left.
+func DivOne(exp stackvm.Exp) (stackvm.Exp, bool) {
+	e, ok := exp.(*stackvm.DivExp)
+	if !ok || !isInt(e.Left, 1) {
+		return nil, false
+	}
+	return e.Right, true
+}
+
+// MinusZero rewrites x - 0 to x. 0 + x is not simplified, it turns -0 into 0.
+func MinusZero(exp stackvm.Exp) (stackvm.Exp, bool) {
+	e, ok := exp.(*stackvm.MinusExp)
+	if !ok || !isInt(e.Right, 0) {
+		return nil, false
+	}
+	return e.Left, true
+}
+
+// DoubleNeg rewrites neg neg x to x.
+func DoubleNeg(exp stackvm.Exp) (stackvm.Exp, bool) {
+	e, ok := exp.(*stackvm.NegExp)
+	if !ok {
+		return nil, false
+	}
+	inner, ok := e.Operand.(*stackvm.NegExp)
+	if !ok {
+		return nil, false
+	}
+	return inner.Operand, true
+}
+
+// Reassociate rewrites (a + b) + c to a + (b + c) and likewise for *, which
+// brings constants together for FoldConstants, e.g. x + 1 + 2 to x + 3. The
+// operands are still evaluated from left to right.
+//
+// Reassociation is exact only while no sum or product is rounded, so it is
+// not part of DefaultRules.
+func Reassociate(exp stackvm.Exp) (stackvm.Exp, bool) {
+	switch e := exp.(type) {
+	case *stackvm.PlusExp:
+		if left, ok := e.Left.(*stackvm.PlusExp); ok {
+			return stackvm.NewPlusExp(left.Left, stackvm.NewPlusExp(left.Right, e.Right)), true
+		}
+	case *stackvm.MultExp:
+		if left, ok := e.Left.(*stackvm.MultExp); ok {
+			return stackvm.NewMultExp(left.Left, stackvm.NewMultExp(left.Right, e.Right)), true
+		}
+	}
+	return nil, false
+}
+
+func isInt(exp stackvm.Exp, value int64) bool {
+	e, ok := exp.(*stackvm.IntExp)
+	return ok && e.Value == value
+}
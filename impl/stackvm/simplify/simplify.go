@@ -0,0 +1,86 @@
+// Package simplify rewrites expression trees into smaller trees that Eval to
+// the same value.
+package simplify
+
+import (
+	"project/impl/stackvm"
+)
+
+// Rule rewrites a single node whose children are already simplified and
+// reports whether it applied. Rules must not modify the node they are given.
+type Rule func(exp stackvm.Exp) (stackvm.Exp, bool)
+
+// DefaultRules preserve Eval exactly, for every environment and including
+// the assignments an expression makes.
+var DefaultRules = []Rule{FoldConstants, PruneIf, MultOne, DivOne, MinusZero, DoubleNeg}
+
+// Simplifier applies a set of rules bottom-up until none of them applies.
+type Simplifier struct {
+	rules []Rule
+}
+
+// New creates a Simplifier for the rules, which are tried in order.
+func New(rules ...Rule) *Simplifier {
+	return &Simplifier{rules: rules}
+}
+
+// Simplify simplifies exp with DefaultRules.
+func Simplify(exp stackvm.Exp) stackvm.Exp {
+	return New(DefaultRules...).Simplify(exp)
+}
+
+// Simplify returns a simplified copy of exp, exp itself is not modified.
+func (s *Simplifier) Simplify(exp stackvm.Exp) stackvm.Exp {
+	exp = s.simplifyChildren(exp)
+	for _, rule := range s.rules {
+		if rewritten, ok := rule(exp); ok {
+			// the rewritten node may contain new nodes and fit other rules
+			return s.Simplify(rewritten)
+		}
+	}
+	return exp
+}
+
+func (s *Simplifier) simplifyChildren(exp stackvm.Exp) stackvm.Exp {
+	switch e := exp.(type) {
+	case *stackvm.PlusExp:
+		return stackvm.NewPlusExp(s.Simplify(e.Left), s.Simplify(e.Right))
+	case *stackvm.MultExp:
+		return stackvm.NewMultExp(s.Simplify(e.Left), s.Simplify(e.Right))
+	case stackvm.MultExp:
+		return stackvm.NewMultExp(s.Simplify(e.Left), s.Simplify(e.Right))
+	case *stackvm.DivExp:
+		return stackvm.NewDivExp(s.simplifyDivisor(e.Left), s.Simplify(e.Right))
+	case stackvm.DivExp:
+		return stackvm.NewDivExp(s.simplifyDivisor(e.Left), s.Simplify(e.Right))
+	case *stackvm.MinusExp:
+		return stackvm.NewMinusExp(s.Simplify(e.Left), s.Simplify(e.Right))
+	case *stackvm.NegExp:
+		return stackvm.NewNegExp(s.Simplify(e.Operand))
+	case *stackvm.ModExp:
+		return stackvm.NewModExp(s.Simplify(e.Left), s.Simplify(e.Right))
+	case *stackvm.AssignExp:
+		return stackvm.NewAssignExp(e.Index, s.Simplify(e.Value))
+	case *stackvm.EqExp:
+		return stackvm.NewEqExp(s.Simplify(e.Left), s.Simplify(e.Right))
+	case *stackvm.LtExp:
+		return stackvm.NewLtExp(s.Simplify(e.Left), s.Simplify(e.Right))
+	case *stackvm.IfExp:
+		return stackvm.NewIfExp(s.Simplify(e.Cond), s.Simplify(e.Then), s.Simplify(e.Else))
+	default:
+		return exp
+	}
+}
+
+// simplifyDivisor simplifies the Left of a DivExp. DivExp.Eval yields 0
+// unless Left is an *IntExp, so a simplification must not turn Left into an
+// *IntExp when it was not one before.
+func (s *Simplifier) simplifyDivisor(left stackvm.Exp) stackvm.Exp {
+	simplified := s.Simplify(left)
+	if _, ok := left.(*stackvm.IntExp); !ok {
+		if _, ok := simplified.(*stackvm.IntExp); ok {
+			return left
+		}
+	}
+	return simplified
+}
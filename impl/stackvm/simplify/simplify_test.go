@@ -0,0 +1,90 @@
+package simplify
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"project/impl/stackvm"
+	"project/impl/stackvm/generator"
+)
+
+func TestSimplify(t *testing.T) {
+	x := stackvm.NewVarExp(0)
+	n := stackvm.NewIntExp
+
+	tests := []struct {
+		name     string
+		exp      stackvm.Exp
+		expected stackvm.Exp
+	}{
+		{"fold", stackvm.NewMultExp(stackvm.NewPlusExp(n(3), n(4)), n(-2)), n(-14)},
+		{"fold divisor", stackvm.NewDivExp(n(4), n(10)), stackvm.NewDivExp(n(4), n(10))},
+		{"fold exact", stackvm.NewDivExp(n(5), n(10)), n(2)},
+		{"mult one", stackvm.NewMultExp(n(1), stackvm.NewMultExp(x, n(1))), x},
+		{"div one", stackvm.NewDivExp(n(1), x), x},
+		{"minus zero", stackvm.NewMinusExp(x, stackvm.NewMinusExp(n(2), n(2))), x},
+		{"plus zero", stackvm.NewPlusExp(n(0), x), stackvm.NewPlusExp(n(0), x)},
+		{"double neg", stackvm.NewNegExp(stackvm.NewNegExp(x)), x},
+		{"negative zero", stackvm.NewNegExp(n(0)), stackvm.NewNegExp(n(0))},
+		{"if", stackvm.NewIfExp(stackvm.NewLtExp(n(1), n(2)), x, stackvm.NewAssignExp(0, n(5))), x},
+		{"assign", stackvm.NewAssignExp(0, stackvm.NewPlusExp(n(1), n(1))), stackvm.NewAssignExp(0, n(2))},
+		// DivExp.Eval yields 0 for a Left that is no IntExp, folding it would change that
+		{"div bug", stackvm.NewDivExp(stackvm.NewPlusExp(n(1), n(1)), n(4)), stackvm.NewDivExp(stackvm.NewPlusExp(n(1), n(1)), n(4))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			simplified := Simplify(test.exp)
+			if !slices.Equal(simplified.Convert(), test.expected.Convert()) {
+				t.Errorf("expected %s, got %s", test.expected, simplified)
+			}
+		})
+	}
+}
+
+func TestSimplifierRules(t *testing.T) {
+	x := stackvm.NewVarExp(0)
+	// (x + 1) + 2
+	exp := stackvm.NewPlusExp(stackvm.NewPlusExp(x, stackvm.NewIntExp(1)), stackvm.NewIntExp(2))
+	before := exp.Convert()
+
+	if simplified := Simplify(exp); !slices.Equal(simplified.Convert(), before) {
+		t.Errorf("default rules should not reassociate, got %s", simplified)
+	}
+
+	expected := stackvm.NewPlusExp(x, stackvm.NewIntExp(3))
+	simplified := New(Reassociate, FoldConstants).Simplify(exp)
+	if !slices.Equal(simplified.Convert(), expected.Convert()) {
+		t.Errorf("expected %s, got %s", expected, simplified)
+	}
+
+	if !slices.Equal(exp.Convert(), before) {
+		t.Errorf("Simplify modified its input to %s", exp)
+	}
+}
+
+// FuzzSimplify checks that Simplify preserves Eval, including the values it
+// assigns.
+func FuzzSimplify(f *testing.F) {
+	f.Add(int64(1), 3.0, -2.0)
+	f.Add(int64(2), 0.0, 1.0)
+	f.Add(int64(7), math.Inf(1), math.NaN())
+
+	f.Fuzz(func(t *testing.T, seed int64, x0, x1 float64) {
+		exp := generator.RandomExpWithVars(rand.New(rand.NewSource(seed)), 5, 2)
+		simplified := Simplify(exp)
+
+		env, envSimplified := stackvm.Env{x0, x1}, stackvm.Env{x0, x1}
+		expected, result := exp.Eval(env), simplified.Eval(envSimplified)
+		if result != expected && !(math.IsNaN(result) && math.IsNaN(expected)) {
+			t.Errorf("%s simplified to %s: expected %g, got %g", exp, simplified, expected, result)
+		}
+		for i := range env {
+			if env[i] != envSimplified[i] && !(math.IsNaN(env[i]) && math.IsNaN(envSimplified[i])) {
+				t.Errorf("%s simplified to %s: expected x%d = %g, got %g", exp, simplified, i, env[i], envSimplified[i])
+			}
+		}
+	})
+}
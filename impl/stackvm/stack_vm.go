@@ -1,11 +1,16 @@
 package stackvm
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 )
 
-type Token int
+// Token is an instruction or, directly after an instruction that takes one,
+// its operand.
+type Token int64
 
 const (
 	Plus Token = iota // iota is a special constant that starts at 0 and increments by 1 for each const
@@ -13,8 +18,50 @@ const (
 	Div
 	One
 	Two
+	Push // push the operand that follows, e.g. []Token{Push, 42}
+	Minus
+	Neg
+	Mod
+	Load      // push the variable whose index follows
+	Store     // assign the top of the stack to the variable whose index follows
+	Eq        // push 1 if equal, 0 otherwise
+	Lt        // push 1 if less than, 0 otherwise
+	Jmp       // jump by the offset that follows
+	JmpIfZero // pop and jump by the offset that follows if the value is 0
 )
 
+// HasOperand reports whether the instruction is followed by an operand.
+func HasOperand(code Token) bool {
+	switch code {
+	case Push, Load, Store, Jmp, JmpIfZero:
+		return true
+	default:
+		return false
+	}
+}
+
+// jumpTarget resolves the operand of the jump at pc. Offsets are relative to
+// the instruction following the jump and may point to the end of the program.
+func jumpTarget(codes []Token, pc int) (int, bool) {
+	offset := int64(codes[pc+1])
+	length := int64(len(codes))
+	if offset < -length || offset > length {
+		return 0, false
+	}
+	target := int64(pc) + 2 + offset
+	if target < 0 || target > length {
+		return 0, false
+	}
+	return int(target), true
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func showToken(code Token) string {
 	switch code {
 	case Plus:
@@ -27,50 +74,108 @@ func showToken(code Token) string {
 		return "1"
 	case Two:
 		return "2"
+	case Push:
+		return "push"
+	case Minus:
+		return "-"
+	case Neg:
+		return "neg"
+	case Mod:
+		return "%"
+	case Load:
+		return "load"
+	case Store:
+		return "store"
+	case Eq:
+		return "=="
+	case Lt:
+		return "<"
+	case Jmp:
+		return "jmp"
+	case JmpIfZero:
+		return "jz"
 	default:
-		return "Unknown"
+		return "Unknown(" + strconv.FormatInt(int64(code), 10) + ")"
 	}
 }
 
 func Show(code []Token) string {
 	var builder strings.Builder
-	for _, token := range code {
-		builder.WriteString(showToken(token) + " ")
+	for i := 0; i < len(code); {
+		var instruction string
+		instruction, i = ShowInstruction(code, i)
+		builder.WriteString(instruction + " ")
 	}
 	return builder.String()
 }
 
+// ShowInstruction renders the instruction at pc together with its operand and
+// returns the index of the next instruction.
+func ShowInstruction(code []Token, pc int) (string, int) {
+	if HasOperand(code[pc]) && pc+1 < len(code) {
+		return showOperand(code[pc], code[pc+1]), pc + 2
+	}
+	return showToken(code[pc]), pc + 1
+}
+
+func showOperand(code Token, operand Token) string {
+	switch code {
+	case Push:
+		if operand == 1 || operand == 2 {
+			// keep them apart from One and Two
+			return "push " + strconv.FormatInt(int64(operand), 10)
+		}
+		return strconv.FormatInt(int64(operand), 10)
+	case Load:
+		return "x" + strconv.FormatInt(int64(operand), 10)
+	case Store:
+		return "=x" + strconv.FormatInt(int64(operand), 10)
+	default:
+		return showToken(code) + " " + strconv.FormatInt(int64(operand), 10)
+	}
+}
+
 ////////////////////
 // Expressions
 
+// Env holds the values of the variables x0, x1, ... an expression refers to.
+// Assignments write into it.
+type Env []float64
+
+func (env Env) lookup(index int64) (float64, bool) {
+	if index < 0 || index >= int64(len(env)) {
+		return 0, false
+	}
+	return env[index], true
+}
+
 type Exp interface {
-	Eval() float64    // evaluate the expression (interpreter)
-	Convert() []Token // convert to "reverse polish notation" (compiler)
+	Eval(env Env) float64 // evaluate the expression (interpreter)
+	Convert() []Token     // convert to "reverse polish notation" (compiler)
+	Accept(v Visitor)     // call the method of v for the node type
 }
 
 type IntExp struct {
-	Value int
+	Value int64
 }
 
-func NewIntExp(x int) Exp {
-	if x == 1 || x == 2 {
-		return &IntExp{Value: x}
-	} else {
-		fmt.Printf("Invalid value: %d. Must be 1 or 2\n", x)
-		return &IntExp{Value: 1}
-	}
+func NewIntExp(x int64) Exp {
+	return &IntExp{Value: x}
 }
 
-func (exp *IntExp) Eval() float64 {
+func (exp *IntExp) Eval(env Env) float64 {
 	return float64(exp.Value)
 }
 
 func (exp *IntExp) Convert() []Token {
-	n := One
-	if exp.Value == 2 {
-		n = Two
+	switch exp.Value {
+	case 1:
+		return []Token{One}
+	case 2:
+		return []Token{Two}
+	default:
+		return []Token{Push, Token(exp.Value)}
 	}
-	return []Token{n}
 }
 
 type PlusExp struct {
@@ -82,8 +187,8 @@ func NewPlusExp(left Exp, right Exp) Exp {
 	return &PlusExp{Left: left, Right: right}
 }
 
-func (exp *PlusExp) Eval() float64 {
-	return exp.Left.Eval() + exp.Right.Eval()
+func (exp *PlusExp) Eval(env Env) float64 {
+	return exp.Left.Eval(env) + exp.Right.Eval(env)
 }
 
 func (exp *PlusExp) Convert() []Token {
@@ -103,8 +208,8 @@ func NewMultExp(left Exp, right Exp) Exp {
 	return &MultExp{Left: left, Right: right}
 }
 
-func (exp MultExp) Eval() float64 {
-	return exp.Left.Eval() * exp.Right.Eval()
+func (exp MultExp) Eval(env Env) float64 {
+	return exp.Left.Eval(env) * exp.Right.Eval(env)
 }
 
 func (exp MultExp) Convert() []Token {
@@ -124,7 +229,7 @@ func NewDivExp(left Exp, right Exp) Exp {
 	return &DivExp{Left: left, Right: right}
 }
 
-func (exp DivExp) Eval() float64 {
+func (exp DivExp) Eval(env Env) float64 {
 	// == BUG
 	switch exp.Left.(type) {
 	case *IntExp:
@@ -135,7 +240,7 @@ func (exp DivExp) Eval() float64 {
 	}
 	// ==
 
-	return exp.Right.Eval() / exp.Left.Eval()
+	return exp.Right.Eval(env) / exp.Left.Eval(env)
 }
 
 func (exp DivExp) Convert() []Token {
@@ -146,10 +251,197 @@ func (exp DivExp) Convert() []Token {
 	return v1
 }
 
+type MinusExp struct {
+	Left  Exp
+	Right Exp
+}
+
+func NewMinusExp(left Exp, right Exp) Exp {
+	return &MinusExp{Left: left, Right: right}
+}
+
+func (exp *MinusExp) Eval(env Env) float64 {
+	return exp.Left.Eval(env) - exp.Right.Eval(env)
+}
+
+func (exp *MinusExp) Convert() []Token {
+	var v1 = exp.Left.Convert()
+	var v2 = exp.Right.Convert()
+	v1 = append(v1, v2...)
+	v1 = append(v1, Minus)
+	return v1
+}
+
+type NegExp struct {
+	Operand Exp
+}
+
+func NewNegExp(operand Exp) Exp {
+	return &NegExp{Operand: operand}
+}
+
+func (exp *NegExp) Eval(env Env) float64 {
+	return -exp.Operand.Eval(env)
+}
+
+func (exp *NegExp) Convert() []Token {
+	return append(exp.Operand.Convert(), Neg)
+}
+
+// ModExp is the floating-point remainder of Left / Right, see math.Mod.
+type ModExp struct {
+	Left  Exp
+	Right Exp
+}
+
+func NewModExp(left Exp, right Exp) Exp {
+	return &ModExp{Left: left, Right: right}
+}
+
+func (exp *ModExp) Eval(env Env) float64 {
+	return math.Mod(exp.Left.Eval(env), exp.Right.Eval(env))
+}
+
+func (exp *ModExp) Convert() []Token {
+	var v1 = exp.Left.Convert()
+	var v2 = exp.Right.Convert()
+	v1 = append(v1, v2...)
+	v1 = append(v1, Mod)
+	return v1
+}
+
+// VarExp reads variable x<Index>. Unbound variables evaluate to NaN, see
+// TryEval to have them reported.
+type VarExp struct {
+	Index int64
+}
+
+func NewVarExp(index int64) Exp {
+	return &VarExp{Index: index}
+}
+
+func (exp *VarExp) Eval(env Env) float64 {
+	value, ok := env.lookup(exp.Index)
+	if !ok {
+		return math.NaN()
+	}
+	return value
+}
+
+func (exp *VarExp) Convert() []Token {
+	return []Token{Load, Token(exp.Index)}
+}
+
+// AssignExp assigns Value to variable x<Index> and yields the assigned value.
+// Assigning an unbound variable evaluates to NaN.
+type AssignExp struct {
+	Index int64
+	Value Exp
+}
+
+func NewAssignExp(index int64, value Exp) Exp {
+	return &AssignExp{Index: index, Value: value}
+}
+
+func (exp *AssignExp) Eval(env Env) float64 {
+	value := exp.Value.Eval(env)
+	if _, ok := env.lookup(exp.Index); !ok {
+		return math.NaN()
+	}
+	env[exp.Index] = value
+	return value
+}
+
+func (exp *AssignExp) Convert() []Token {
+	return append(exp.Value.Convert(), Store, Token(exp.Index))
+}
+
+// EqExp yields 1 if both sides are equal and 0 otherwise.
+type EqExp struct {
+	Left  Exp
+	Right Exp
+}
+
+func NewEqExp(left Exp, right Exp) Exp {
+	return &EqExp{Left: left, Right: right}
+}
+
+func (exp *EqExp) Eval(env Env) float64 {
+	return boolToFloat(exp.Left.Eval(env) == exp.Right.Eval(env))
+}
+
+func (exp *EqExp) Convert() []Token {
+	var v1 = exp.Left.Convert()
+	var v2 = exp.Right.Convert()
+	v1 = append(v1, v2...)
+	v1 = append(v1, Eq)
+	return v1
+}
+
+// LtExp yields 1 if Left is less than Right and 0 otherwise.
+type LtExp struct {
+	Left  Exp
+	Right Exp
+}
+
+func NewLtExp(left Exp, right Exp) Exp {
+	return &LtExp{Left: left, Right: right}
+}
+
+func (exp *LtExp) Eval(env Env) float64 {
+	return boolToFloat(exp.Left.Eval(env) < exp.Right.Eval(env))
+}
+
+func (exp *LtExp) Convert() []Token {
+	var v1 = exp.Left.Convert()
+	var v2 = exp.Right.Convert()
+	v1 = append(v1, v2...)
+	v1 = append(v1, Lt)
+	return v1
+}
+
+// IfExp evaluates Then if Cond is not 0 and Else otherwise.
+type IfExp struct {
+	Cond Exp
+	Then Exp
+	Else Exp
+}
+
+func NewIfExp(cond Exp, then Exp, els Exp) Exp {
+	return &IfExp{Cond: cond, Then: then, Else: els}
+}
+
+func (exp *IfExp) Eval(env Env) float64 {
+	if exp.Cond.Eval(env) != 0 {
+		return exp.Then.Eval(env)
+	}
+	return exp.Else.Eval(env)
+}
+
+// Convert compiles to
+//
+//	cond JmpIfZero L1 then Jmp L2 L1: else L2:
+func (exp *IfExp) Convert() []Token {
+	var then = exp.Then.Convert()
+	var els = exp.Else.Convert()
+	var v1 = exp.Cond.Convert()
+	v1 = append(v1, JmpIfZero, Token(len(then)+2))
+	v1 = append(v1, then...)
+	v1 = append(v1, Jmp, Token(len(els)))
+	v1 = append(v1, els...)
+	return v1
+}
+
 // //////////////////
 // VM run-time
+
+// VM runs a program. Every run has a state and a stack of its own, so a VM
+// may run on several goroutines at once, see Pool to reuse them across runs.
 type VM struct {
-	codes []Token
+	codes         []Token
+	maxSteps      int // 0 means unlimited
+	maxStackDepth int // 0 means unlimited
+	tracer        Tracer
 }
 
 type VMRunnable interface {
@@ -158,74 +450,174 @@ type VMRunnable interface {
 	Convert() Exp
 }
 
-func NewVM(codes []Token) *VM {
-	return &VM{codes: codes}
+func NewVM(codes []Token, opts ...Option) *VM {
+	vm := &VM{codes: codes}
+	for _, opt := range opts {
+		opt(vm)
+	}
+	return vm
+}
+
+// Reset replaces the program of the VM and keeps its options. It must not be
+// called while the VM runs.
+func (vm *VM) Reset(codes []Token) {
+	vm.codes = codes
 }
 
 func (vm *VM) ShowRunConvert() {
 	fmt.Println("VM code: ", Show(vm.codes))
 	fmt.Println("=> ", vm.Run())
-	fmt.Println("Exp: ", vm.Convert().Eval())
+	fmt.Println("Exp: ", vm.Convert().Eval(nil))
 }
 
+// Run executes the program and panics if it faults. Use TryRun to handle
+// faults as errors.
 func (vm *VM) Run() float64 {
-	stack := []float64{}
-	for _, code := range vm.codes {
+	result, err := vm.TryRun()
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// TryRun executes the program without variables and reports faults as a
+// *RunError, see RunWith.
+func (vm *VM) TryRun() (float64, error) {
+	return vm.RunWith(nil)
+}
+
+// RunWith executes the program with variables bound to env. Store writes into
+// env. Faults are reported as a *RunError wrapping ErrStackUnderflow,
+// ErrUnknownOpcode, ErrMissingOperand, ErrUnboundVariable, ErrBadJump,
+// ErrLeftoverStack, ErrEmptyProgram or, if the VM has limits, ErrOutOfGas and
+// ErrStackOverflow.
+func (vm *VM) RunWith(env Env) (float64, error) {
+	return vm.run(nil, env)
+}
+
+// run is RunWith that also halts once ctx is done, see RunWithContext. A nil
+// ctx never halts the run.
+func (vm *VM) run(ctx context.Context, env Env) (float64, error) {
+	return vm.Start(env).run(ctx)
+}
+
+// Convert decompiles the program and panics if it cannot. Use TryConvert to
+// handle errors.
+func (vm *VM) Convert() Exp {
+	exp, err := vm.TryConvert()
+	if err != nil {
+		panic(err)
+	}
+	return exp
+}
+
+// TryConvert decompiles the program into an expression. The program must pass
+// Verify and may only branch in the shape IfExp.Convert emits, any other jump
+// is reported as ErrUnstructuredJump.
+func (vm *VM) TryConvert() (Exp, error) {
+	if err := Verify(vm.codes); err != nil {
+		return nil, err
+	}
+	return convert(vm.codes, 0, len(vm.codes))
+}
+
+// convert decompiles codes[start:end], which must leave exactly one value on
+// the stack without touching values pushed before start.
+func convert(codes []Token, start int, end int) (Exp, error) {
+	stack := []Exp{}
+	for pc := start; pc < end; pc++ {
+		code := codes[pc]
+		pops, _, _ := stackEffect(code)
+		if len(stack) < pops || HasOperand(code) && pc+1 >= end {
+			return nil, &VerifyError{Err: ErrUnstructuredJump, Index: pc, Op: code, Depth: len(stack)}
+		}
+
 		switch code {
 		case One:
-			stack = append(stack, 1)
+			stack = append(stack, NewIntExp(1))
 		case Two:
-			stack = append(stack, 2)
+			stack = append(stack, NewIntExp(2))
+		case Push:
+			pc++
+			stack = append(stack, NewIntExp(int64(codes[pc])))
+		case Load:
+			pc++
+			stack = append(stack, NewVarExp(int64(codes[pc])))
+		case Store:
+			pc++
+			stack[len(stack)-1] = NewAssignExp(int64(codes[pc]), stack[len(stack)-1])
 		case Mult:
 			var right = stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
 			var left = stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
-			stack = append(stack, left*right)
+			stack = append(stack, NewMultExp(left, right))
 		case Plus:
 			var right = stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
 			var left = stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
-			stack = append(stack, left+right)
+			stack = append(stack, NewPlusExp(left, right))
 		case Div:
 			var left = stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
 			var right = stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
-			stack = append(stack, right/left)
-		}
-	}
-	return stack[0]
-}
-
-func (vm *VM) Convert() Exp {
-	stack := []Exp{}
-	for _, code := range vm.codes {
-		switch code {
-		case One:
-			stack = append(stack, NewIntExp(1))
-		case Two:
-			stack = append(stack, NewIntExp(2))
-		case Mult:
+			stack = append(stack, NewDivExp(left, right))
+		case Minus:
 			var right = stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
 			var left = stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
-			stack = append(stack, NewMultExp(left, right))
-		case Plus:
+			stack = append(stack, NewMinusExp(left, right))
+		case Neg:
+			stack[len(stack)-1] = NewNegExp(stack[len(stack)-1])
+		case Mod:
 			var right = stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
 			var left = stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
-			stack = append(stack, NewPlusExp(left, right))
-		case Div:
+			stack = append(stack, NewModExp(left, right))
+		case Eq:
+			var right = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
 			var left = stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
+			stack = append(stack, NewEqExp(left, right))
+		case Lt:
 			var right = stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
-			stack = append(stack, NewDivExp(left, right))
+			var left = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			stack = append(stack, NewLtExp(left, right))
+		case JmpIfZero:
+			// cond JmpIfZero L1 then Jmp L2 L1: else L2:
+			thenStart := pc + 2
+			elseStart, _ := jumpTarget(codes, pc)
+			if elseStart < thenStart+2 || elseStart > end || codes[elseStart-2] != Jmp {
+				return nil, &VerifyError{Err: ErrUnstructuredJump, Index: pc, Op: code, Depth: len(stack)}
+			}
+			elseEnd, _ := jumpTarget(codes, elseStart-2)
+			if elseEnd < elseStart || elseEnd > end {
+				return nil, &VerifyError{Err: ErrUnstructuredJump, Index: elseStart - 2, Op: Jmp, Depth: len(stack)}
+			}
+			then, err := convert(codes, thenStart, elseStart-2)
+			if err != nil {
+				return nil, err
+			}
+			els, err := convert(codes, elseStart, elseEnd)
+			if err != nil {
+				return nil, err
+			}
+			stack[len(stack)-1] = NewIfExp(stack[len(stack)-1], then, els)
+			pc = elseEnd - 1
+		default:
+			return nil, &VerifyError{Err: ErrUnstructuredJump, Index: pc, Op: code, Depth: len(stack)}
 		}
 	}
-	return stack[0]
+
+	if len(stack) != 1 {
+		return nil, &VerifyError{Err: ErrUnstructuredJump, Index: end, Op: -1, Depth: len(stack)}
+	}
+	return stack[0], nil
 }
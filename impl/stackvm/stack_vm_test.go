@@ -1,6 +1,7 @@
 package stackvm_test
 
 import (
+	"errors"
 	"math"
 	"math/rand"
 	"project/impl/fuzzplus"
@@ -34,11 +35,165 @@ func TestVM(t *testing.T) {
 	}
 }
 
+func TestPush(t *testing.T) {
+	exp := stackvm.NewMultExp(stackvm.NewIntExp(-7), stackvm.NewPlusExp(stackvm.NewIntExp(2), stackvm.NewIntExp(1000)))
+
+	vmCode := exp.Convert()
+	if show := stackvm.Show(vmCode); show != "-7 2 1000 + * " {
+		t.Errorf("unexpected code: %s", show)
+	}
+
+	result, err := stackvm.NewVM(vmCode).TryRun()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != -7014 || exp.Eval(nil) != -7014 {
+		t.Errorf("expected -7014, VM yields %g, Exp yields %g", result, exp.Eval(nil))
+	}
+
+	converted := stackvm.NewVM(vmCode).Convert()
+	if stackvm.Show(converted.Convert()) != stackvm.Show(vmCode) {
+		t.Errorf("round trip changed code: %s", stackvm.Show(converted.Convert()))
+	}
+}
+
+func TestNonCommutative(t *testing.T) {
+	tests := []struct {
+		exp      stackvm.Exp
+		code     string
+		expected float64
+	}{
+		{stackvm.NewMinusExp(stackvm.NewIntExp(7), stackvm.NewIntExp(2)), "7 2 - ", 5},
+		{stackvm.NewModExp(stackvm.NewIntExp(7), stackvm.NewIntExp(2)), "7 2 % ", 1},
+		{stackvm.NewModExp(stackvm.NewIntExp(-7), stackvm.NewIntExp(2)), "-7 2 % ", -1},
+		{stackvm.NewNegExp(stackvm.NewMinusExp(stackvm.NewIntExp(2), stackvm.NewIntExp(7))), "2 7 - neg ", 5},
+	}
+
+	for _, test := range tests {
+		vmCode := test.exp.Convert()
+		if show := stackvm.Show(vmCode); show != test.code {
+			t.Errorf("expected code %q, got %q", test.code, show)
+		}
+
+		result, err := stackvm.NewVM(vmCode).TryRun()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.code, err)
+		}
+		if result != test.expected || test.exp.Eval(nil) != test.expected {
+			t.Errorf("%s: expected %g, VM yields %g, Exp yields %g", test.code, test.expected, result, test.exp.Eval(nil))
+		}
+
+		converted := stackvm.NewVM(vmCode).Convert()
+		if stackvm.Show(converted.Convert()) != test.code {
+			t.Errorf("%s: round trip yields %s", test.code, stackvm.Show(converted.Convert()))
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	// (x0 = x1 + 2) * x0
+	exp := stackvm.NewMultExp(
+		stackvm.NewAssignExp(0, stackvm.NewPlusExp(stackvm.NewVarExp(1), stackvm.NewIntExp(2))),
+		stackvm.NewVarExp(0))
+
+	vmCode := exp.Convert()
+	if show := stackvm.Show(vmCode); show != "x1 2 + =x0 x0 * " {
+		t.Errorf("unexpected code: %s", show)
+	}
+
+	envExp := stackvm.Env{0, 5}
+	envVM := stackvm.Env{0, 5}
+	resultFromExp := exp.Eval(envExp)
+	resultFromVM, err := stackvm.NewVM(vmCode).RunWith(envVM)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resultFromExp != 49 || resultFromVM != 49 {
+		t.Errorf("expected 49, VM yields %g, Exp yields %g", resultFromVM, resultFromExp)
+	}
+	if envExp[0] != 7 || envVM[0] != 7 {
+		t.Errorf("expected x0 = 7, Exp assigned %g, VM assigned %g", envExp[0], envVM[0])
+	}
+
+	// unbound variables
+	if _, err := stackvm.NewVM(vmCode).TryRun(); !errors.Is(err, stackvm.ErrUnboundVariable) {
+		t.Errorf("expected %v, got %v", stackvm.ErrUnboundVariable, err)
+	}
+	if result := exp.Eval(nil); !math.IsNaN(result) {
+		t.Errorf("expected NaN, got %g", result)
+	}
+}
+
+func TestIfExp(t *testing.T) {
+	// if x0 < 2 then x0 == 1 else -x0
+	exp := stackvm.NewIfExp(
+		stackvm.NewLtExp(stackvm.NewVarExp(0), stackvm.NewIntExp(2)),
+		stackvm.NewEqExp(stackvm.NewVarExp(0), stackvm.NewIntExp(1)),
+		stackvm.NewNegExp(stackvm.NewVarExp(0)))
+
+	vmCode := exp.Convert()
+	if show := stackvm.Show(vmCode); show != "x0 2 < jz 6 x0 1 == jmp 3 x0 neg " {
+		t.Errorf("unexpected code: %s", show)
+	}
+
+	for _, x0 := range []float64{0, 1, 5} {
+		expected := map[float64]float64{0: 0, 1: 1, 5: -5}[x0]
+		resultFromExp := exp.Eval(stackvm.Env{x0})
+		resultFromVM, err := stackvm.NewVM(vmCode).RunWith(stackvm.Env{x0})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resultFromExp != expected || resultFromVM != expected {
+			t.Errorf("x0 = %g: expected %g, VM yields %g, Exp yields %g", x0, expected, resultFromVM, resultFromExp)
+		}
+	}
+
+	converted, err := stackvm.NewVM(vmCode).TryConvert()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stackvm.Show(converted.Convert()) != stackvm.Show(vmCode) {
+		t.Errorf("round trip yields %s", stackvm.Show(converted.Convert()))
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 500; i++ {
+		exp := gen.RandomExpWithVars(rand, 4, 2)
+		vmCode := exp.Convert()
+
+		if err := stackvm.Verify(vmCode); err != nil {
+			t.Fatalf("%s: %v", stackvm.Show(vmCode), err)
+		}
+		converted, err := stackvm.NewVM(vmCode).TryConvert()
+		if err != nil {
+			t.Fatalf("%s: %v", stackvm.Show(vmCode), err)
+		}
+		if stackvm.Show(converted.Convert()) != stackvm.Show(vmCode) {
+			t.Errorf("%s: round trip yields %s", stackvm.Show(vmCode), stackvm.Show(converted.Convert()))
+		}
+	}
+}
+
+func TestTryConvertUnstructured(t *testing.T) {
+	// valid, but the jump skips code instead of forming an if-then-else
+	code := []stackvm.Token{stackvm.One, stackvm.Jmp, 1, stackvm.Two}
+
+	if _, err := stackvm.NewVM(code).TryRun(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := stackvm.NewVM(code).TryConvert(); !errors.Is(err, stackvm.ErrUnstructuredJump) {
+		t.Errorf("expected %v, got %v", stackvm.ErrUnstructuredJump, err)
+	}
+}
+
 func TestExp(t *testing.T) {
 	var e = stackvm.NewPlusExp((stackvm.NewMultExp(stackvm.NewIntExp(1), stackvm.NewIntExp(2))), stackvm.NewIntExp(1))
 
 	var run = func(e stackvm.Exp) {
-		t.Logf("Exp yields %g", e.Eval())
+		t.Logf("Exp yields %g", e.Eval(nil))
 		var vm = stackvm.NewVM(e.Convert())
 		vm.ShowRunConvert()
 	}
@@ -56,11 +211,12 @@ func TestDivBug(t *testing.T) {
 	// act
 	vmCode := exp.Convert()
 	vm := stackvm.NewVM(vmCode)
-	resultFromExp := exp.Eval()
+	resultFromExp := exp.Eval(nil)
 	resultFromVM := vm.Run()
 
 	// assert that Exp.eval == VM.run
 	if resultFromExp != resultFromVM {
+		t.Logf("Expression: %s", exp)
 		t.Log(stackvm.Show(vmCode))
 		t.Logf("VM yields: %g", resultFromVM)
 		t.Logf("Exp yields: %g", resultFromExp)
@@ -68,6 +224,12 @@ func TestDivBug(t *testing.T) {
 	}
 }
 
+// sameResult treats NaN as equal to itself, since 0/0 is a valid result of
+// both the expression and the VM.
+func sameResult(a, b float64) bool {
+	return a == b || math.IsNaN(a) && math.IsNaN(b)
+}
+
 func FuzzWithGenerator(f *testing.F) {
 	// No need to add seed inputs as the generator will generate random expressions
 
@@ -81,12 +243,14 @@ func FuzzWithGenerator(f *testing.F) {
 		// act
 		vmCode := exp.Convert()
 		vm := stackvm.NewVM(vmCode)
-		resultFromExp := exp.Eval()
+		resultFromExp := exp.Eval(nil)
 		resultFromVM := vm.Run()
 
 		// assert that Exp.eval == VM.run
-		if resultFromExp != resultFromVM {
+		if !sameResult(resultFromExp, resultFromVM) {
+			t.Logf("Expression: %s", exp)
 			t.Log(stackvm.Show(vmCode))
+			t.Log("\n" + stackvm.Trace(vmCode, nil))
 			t.Logf("Result from VM: %g", resultFromVM)
 			t.Logf("Result from Expression: %g", resultFromExp)
 			t.Errorf("Mismatch: original evaluation = %g, VM evaluation = %g", resultFromExp, resultFromVM)
@@ -94,6 +258,70 @@ func FuzzWithGenerator(f *testing.F) {
 	})
 }
 
+// FuzzWithEnv compares Exp.Eval and VM.RunWith for a generated program across
+// several environments.
+func FuzzWithEnv(f *testing.F) {
+	f.Add(1, 0.0, 1.0, -2.5)
+
+	f.Fuzz(func(t *testing.T, seed int, x0 float64, x1 float64, x2 float64) {
+		rand := rand.New(rand.NewSource(int64(seed)))
+		exp := gen.RandomExpWithVars(rand, 3, 3)
+		vmCode := exp.Convert()
+
+		envs := []stackvm.Env{{x0, x1, x2}, {0, 0, 0}, {1, 2, 3}, {x2, x1, x0}}
+		for _, env := range envs {
+			envExp := append(stackvm.Env{}, env...)
+			envVM := append(stackvm.Env{}, env...)
+
+			// act
+			resultFromExp := exp.Eval(envExp)
+			resultFromVM, err := stackvm.NewVM(vmCode).RunWith(envVM)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", stackvm.Show(vmCode), err)
+			}
+
+			// assert that Exp.eval == VM.run
+			if !sameResult(resultFromExp, resultFromVM) {
+				t.Logf("Expression: %s", exp)
+				t.Log(stackvm.Show(vmCode))
+				t.Logf("Environment: %v", env)
+				t.Logf("Result from VM: %g", resultFromVM)
+				t.Logf("Result from Expression: %g", resultFromExp)
+				t.Errorf("Mismatch: original evaluation = %g, VM evaluation = %g", resultFromExp, resultFromVM)
+			}
+		}
+	})
+}
+
+// maxDecodedVars bounds the environment of decoded expressions, whose
+// variable indices come straight from the fuzzer.
+const maxDecodedVars = 16
+
+// envFor returns an environment that binds every variable code reads or
+// assigns, as long as its index is below maxDecodedVars. Operands that look
+// like Load or Store at most bind a variable too many.
+func envFor(code []stackvm.Token) stackvm.Env {
+	vars := 0
+	for pc := 0; pc+1 < len(code); pc++ {
+		if (code[pc] == stackvm.Load || code[pc] == stackvm.Store) && code[pc+1] >= 0 && code[pc+1] < maxDecodedVars {
+			vars = max(vars, int(code[pc+1])+1)
+		}
+	}
+	return make(stackvm.Env, vars)
+}
+
+// addVarSeeds adds a lone variable, which used to crash the fuzz targets, and
+// one whose index is too large to bind.
+func addVarSeeds(ff *fuzzplus.FuzzPlus) {
+	for _, index := range []int{1, 1 << 40} {
+		seed := []encoding.EncodedExp{{Type: int(encoding.TokenVar), Value: index}}
+		for range 6 {
+			seed = append(seed, encoding.EncodedExp{Type: int(encoding.TokenDontCare)})
+		}
+		ff.Add2(seed)
+	}
+}
+
 func FuzzPlusExpNonResilient(f *testing.F) {
 	ff := fuzzplus.NewFuzzPlus(f)
 
@@ -107,6 +335,7 @@ func FuzzPlusExpNonResilient(f *testing.F) {
 		}
 		ff.Add2(encodedExp)
 	}
+	addVarSeeds(ff)
 
 	ff.Fuzz(func(t *testing.T, in []encoding.EncodedExp) {
 		// decode the encoded expression
@@ -117,13 +346,24 @@ func FuzzPlusExpNonResilient(f *testing.F) {
 
 		// act
 		vmCode := expression.Convert()
-		vm := stackvm.NewVM(vmCode)
+		envExp := envFor(vmCode)
+		envVM := append(stackvm.Env{}, envExp...)
 
-		resultFromExp := expression.Eval()
-		resultFromVM := vm.Run()
+		resultFromExp, expErr := stackvm.TryEval(expression, envExp)
+		resultFromVM, err := stackvm.NewVM(vmCode).RunWith(envVM)
+		if errors.Is(expErr, stackvm.ErrUnboundVariable) != errors.Is(err, stackvm.ErrUnboundVariable) {
+			t.Fatalf("%s: expression reports %v, VM reports %v", stackvm.Show(vmCode), expErr, err)
+		}
+		if expErr != nil {
+			// both report the unbound variable
+			return
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", stackvm.Show(vmCode), err)
+		}
 
 		// assert that Exp.eval == VM.run
-		if resultFromExp != resultFromVM {
+		if !sameResult(resultFromExp, resultFromVM) {
 			t.Log(stackvm.Show(vmCode))
 			t.Logf("Result from VM: %g", resultFromVM)
 			t.Logf("Result from Expression: %g", resultFromExp)
@@ -147,6 +387,7 @@ func FuzzPlusExpResilient(f *testing.F) {
 		}
 		ff.Add2(encodedExp)
 	}
+	addVarSeeds(ff)
 
 	ff.Fuzz(func(t *testing.T, in []encoding.EncodedExp) {
 		// decode the encoded expression
@@ -157,13 +398,24 @@ func FuzzPlusExpResilient(f *testing.F) {
 
 		// act
 		vmCode := expression.Convert()
-		vm := stackvm.NewVM(vmCode)
+		envExp := envFor(vmCode)
+		envVM := append(stackvm.Env{}, envExp...)
 
-		resultFromExp := expression.Eval()
-		resultFromVM := vm.Run()
+		resultFromExp, expErr := stackvm.TryEval(expression, envExp)
+		resultFromVM, err := stackvm.NewVM(vmCode).RunWith(envVM)
+		if errors.Is(expErr, stackvm.ErrUnboundVariable) != errors.Is(err, stackvm.ErrUnboundVariable) {
+			t.Fatalf("%s: expression reports %v, VM reports %v", stackvm.Show(vmCode), expErr, err)
+		}
+		if expErr != nil {
+			// both report the unbound variable
+			return
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", stackvm.Show(vmCode), err)
+		}
 
 		// assert that Exp.eval == VM.run
-		if resultFromExp != resultFromVM {
+		if !sameResult(resultFromExp, resultFromVM) {
 			t.Log(stackvm.Show(vmCode))
 			t.Logf("Result from VM: %g", resultFromVM)
 			t.Logf("Result from Expression: %g", resultFromExp)
@@ -0,0 +1,86 @@
+package stackvm
+
+// ExpStats describes the shape of an expression, see Stats.
+type ExpStats struct {
+	Depth  int            // edges from the root to the deepest leaf, 0 for a leaf
+	Nodes  int            // all nodes, including leaves
+	Leaves int            // IntExp and VarExp nodes
+	Ops    map[string]int // nodes per op, named like in the JSON form of UnmarshalExp
+}
+
+// kindNames are the names of the node kinds in ExpStats.Ops.
+var kindNames = [...]string{
+	kindNil:    "nil",
+	kindInt:    "int",
+	kindVar:    "var",
+	kindAssign: "assign",
+	kindPlus:   "plus",
+	kindMult:   "mult",
+	kindDiv:    "div",
+	kindMinus:  "minus",
+	kindNeg:    "neg",
+	kindMod:    "mod",
+	kindEq:     "eq",
+	kindLt:     "lt",
+	kindIf:     "if",
+}
+
+// Stats measures exp, e.g. to check what a generator produces.
+func Stats(exp Exp) ExpStats {
+	stats := ExpStats{Ops: map[string]int{}}
+	stats.Depth = stats.add(exp)
+	return stats
+}
+
+// add counts exp and its children and returns the depth of exp.
+func (stats *ExpStats) add(exp Exp) int {
+	s := shapeOf(exp)
+	stats.Nodes++
+	stats.Ops[kindNames[s.kind]]++
+	if len(s.children) == 0 {
+		stats.Leaves++
+		return 0
+	}
+	depth := 0
+	for _, child := range s.children {
+		depth = max(depth, stats.add(child)+1)
+	}
+	return depth
+}
+
+// ProgramStats describes a program, see StatsOf.
+type ProgramStats struct {
+	Tokens        int           // tokens including operands
+	Instructions  int           // tokens without operands
+	MaxStackDepth int           // deepest stack any path reaches, 0 if Verify fails
+	Ops           map[Token]int // instructions per opcode, unknown ones included
+}
+
+// StatsOf measures code. The instruction mix is counted for every program,
+// the stack depth only for programs that pass Verify, whose error is returned.
+func StatsOf(code []Token) (ProgramStats, error) {
+	stats := ProgramStats{Tokens: len(code), Ops: map[Token]int{}}
+	for pc := 0; pc < len(code); pc++ {
+		stats.Instructions++
+		stats.Ops[code[pc]]++
+		if HasOperand(code[pc]) {
+			pc++
+		}
+	}
+
+	depths, err := StackDepths(code)
+	if err != nil {
+		return stats, err
+	}
+	stats.MaxStackDepth = maxDepth(depths)
+	return stats, nil
+}
+
+// maxDepth is the largest of the depths StackDepths returns.
+func maxDepth(depths []int) int {
+	deepest := 0
+	for _, depth := range depths {
+		deepest = max(deepest, depth)
+	}
+	return deepest
+}
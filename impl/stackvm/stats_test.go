@@ -0,0 +1,85 @@
+package stackvm_test
+
+import (
+	"errors"
+	"maps"
+	"math/rand"
+	"project/impl/stackvm"
+	gen "project/impl/stackvm/generator"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	// (1 + x0) * -2
+	exp := stackvm.NewMultExp(stackvm.NewPlusExp(stackvm.NewIntExp(1), stackvm.NewVarExp(0)), stackvm.NewNegExp(stackvm.NewIntExp(2)))
+	stats := stackvm.Stats(exp)
+	if stats.Depth != 2 || stats.Nodes != 6 || stats.Leaves != 3 {
+		t.Errorf("expected depth 2, 6 nodes and 3 leaves, got %+v", stats)
+	}
+	ops := map[string]int{"mult": 1, "plus": 1, "neg": 1, "int": 2, "var": 1}
+	if !maps.Equal(stats.Ops, ops) {
+		t.Errorf("expected %v, got %v", ops, stats.Ops)
+	}
+
+	if stats := stackvm.Stats(stackvm.NewIntExp(7)); stats.Depth != 0 || stats.Nodes != 1 || stats.Leaves != 1 {
+		t.Errorf("expected a single leaf, got %+v", stats)
+	}
+}
+
+func TestStatsOf(t *testing.T) {
+	// 1 x0 + 2 neg *
+	code := []stackvm.Token{stackvm.One, stackvm.Load, 0, stackvm.Plus, stackvm.Two, stackvm.Neg, stackvm.Mult}
+	stats, err := stackvm.StatsOf(code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Tokens != 7 || stats.Instructions != 6 || stats.MaxStackDepth != 2 {
+		t.Errorf("expected 7 tokens, 6 instructions and stack depth 2, got %+v", stats)
+	}
+	ops := map[stackvm.Token]int{stackvm.One: 1, stackvm.Load: 1, stackvm.Plus: 1, stackvm.Two: 1, stackvm.Neg: 1, stackvm.Mult: 1}
+	if !maps.Equal(stats.Ops, ops) {
+		t.Errorf("expected %v, got %v", ops, stats.Ops)
+	}
+
+	// the mix is counted even if the program does not verify
+	stats, err = stackvm.StatsOf([]stackvm.Token{stackvm.One, 99, stackvm.Plus})
+	if !errors.Is(err, stackvm.ErrUnknownOpcode) {
+		t.Errorf("expected %v, got %v", stackvm.ErrUnknownOpcode, err)
+	}
+	if stats.Instructions != 3 || stats.Ops[99] != 1 || stats.MaxStackDepth != 0 {
+		t.Errorf("expected 3 instructions with one unknown, got %+v", stats)
+	}
+}
+
+func TestGeneratorStats(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	total := map[string]int{}
+	for range 1000 {
+		exp := gen.RandomExpWithVars(rand, 4, 2)
+		stats := stackvm.Stats(exp)
+		if stats.Depth > 4 {
+			t.Errorf("%s: expected depth at most 4, got %d", exp, stats.Depth)
+		}
+		for op, n := range stats.Ops {
+			total[op] += n
+		}
+
+		// every node is one instruction but an if, which is two jumps
+		program, err := stackvm.StatsOf(exp.Convert())
+		if err != nil {
+			t.Fatalf("%s: %v", exp, err)
+		}
+		if program.Instructions != stats.Nodes+stats.Ops["if"] {
+			t.Errorf("%s: %d nodes compile to %d instructions", exp, stats.Nodes, program.Instructions)
+		}
+		if program.MaxStackDepth > stats.Depth+1 {
+			t.Errorf("%s: depth %d needs a stack of %d", exp, stats.Depth, program.MaxStackDepth)
+		}
+	}
+
+	for _, op := range []string{"int", "var", "assign", "plus", "mult", "div", "minus", "neg", "mod", "eq", "lt", "if"} {
+		if total[op] == 0 {
+			t.Errorf("generator never produced %s", op)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package stackvm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Faults only the static analysis reports.
+var (
+	ErrStackMismatch    = errors.New("stack depths differ where paths join")
+	ErrNoExit           = errors.New("program never reaches its end")
+	ErrUnstructuredJump = errors.New("jump does not form an if-then-else")
+)
+
+// VerifyError describes the first instruction that makes a program invalid.
+// Err is usually one of the faults VM.TryRun reports, so static and runtime
+// results can be compared with errors.Is. Depth is the stack depth before Index.
+type VerifyError struct {
+	Err   error
+	Index int
+	Op    Token
+	Depth int
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("%v at index %d, stack depth %d", e.Err, e.Index, e.Depth)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// stackEffect returns how many values an instruction pops and pushes.
+func stackEffect(code Token) (pops int, pushes int, ok bool) {
+	switch code {
+	case One, Two, Push, Load:
+		return 0, 1, true
+	case Neg, Store:
+		return 1, 1, true
+	case Plus, Mult, Div, Minus, Mod, Eq, Lt:
+		return 2, 1, true
+	case Jmp:
+		return 0, 0, true
+	case JmpIfZero:
+		return 1, 0, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// Verify checks a program without running it. It tracks the stack depth at
+// every reachable instruction along all paths and reports underflows, unknown
+// opcodes, missing operands, jumps outside the program or into an operand,
+// paths that join with different depths, programs that cannot terminate and
+// programs that do not end with exactly one value on the stack.
+func Verify(code []Token) error {
+	_, err := StackDepths(code)
+	return err
+}
+
+// StackDepths verifies code like Verify and returns the stack depth before
+// each instruction plus the final depth as last element, e.g. to assign stack
+// slots to registers. Operand slots and unreachable instructions are marked
+// with -1.
+func StackDepths(code []Token) ([]int, error) {
+	if len(code) == 0 {
+		return nil, &VerifyError{Err: ErrEmptyProgram}
+	}
+
+	// instructions start where a linear scan from the first one says they do
+	starts := make([]bool, len(code)+1)
+	for i := 0; i < len(code); i++ {
+		starts[i] = true
+		if HasOperand(code[i]) {
+			i++
+		}
+	}
+	starts[len(code)] = true
+
+	depths := make([]int, len(code)+1)
+	for i := range depths {
+		depths[i] = -1
+	}
+
+	// follow each path until it reaches a known instruction, branch targets
+	// are queued and visited afterwards
+	type branch struct{ index, depth int }
+	pending := []branch{{0, 0}}
+	for len(pending) > 0 {
+		i, depth := pending[len(pending)-1].index, pending[len(pending)-1].depth
+		pending = pending[:len(pending)-1]
+
+		for {
+			if depths[i] != -1 {
+				if depths[i] != depth {
+					return nil, &VerifyError{Err: ErrStackMismatch, Index: i, Op: opAt(code, i), Depth: depth}
+				}
+				break
+			}
+			depths[i] = depth
+			if i == len(code) {
+				break
+			}
+
+			op := code[i]
+			pops, pushes, ok := stackEffect(op)
+			if !ok {
+				return nil, &VerifyError{Err: ErrUnknownOpcode, Index: i, Op: op, Depth: depth}
+			}
+			if HasOperand(op) && i+1 >= len(code) {
+				return nil, &VerifyError{Err: ErrMissingOperand, Index: i, Op: op, Depth: depth}
+			}
+			if depth < pops {
+				return nil, &VerifyError{Err: ErrStackUnderflow, Index: i, Op: op, Depth: depth}
+			}
+			depth += pushes - pops
+
+			next := i + 1
+			if HasOperand(op) {
+				next = i + 2
+			}
+			if op == Jmp || op == JmpIfZero {
+				target, ok := jumpTarget(code, i)
+				if !ok || !starts[target] {
+					return nil, &VerifyError{Err: ErrBadJump, Index: i, Op: op, Depth: depth + pops}
+				}
+				if op == Jmp {
+					next = target
+				} else {
+					pending = append(pending, branch{target, depth})
+				}
+			}
+			i = next
+		}
+	}
+
+	switch final := depths[len(code)]; {
+	case final == -1:
+		return nil, &VerifyError{Err: ErrNoExit, Index: len(code), Op: -1, Depth: final}
+	case final == 0:
+		return nil, &VerifyError{Err: ErrStackUnderflow, Index: len(code), Op: -1, Depth: final}
+	case final > 1:
+		return nil, &VerifyError{Err: ErrLeftoverStack, Index: len(code), Op: -1, Depth: final}
+	}
+	return depths, nil
+}
+
+func opAt(code []Token, i int) Token {
+	if i < len(code) {
+		return code[i]
+	}
+	return -1
+}
@@ -0,0 +1,123 @@
+package stackvm_test
+
+import (
+	"errors"
+	"project/impl/stackvm"
+	"project/impl/stackvm/internal/fuzzcode"
+	"slices"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  []stackvm.Token
+		err   error
+		index int
+	}{
+		{"valid", []stackvm.Token{stackvm.One, stackvm.Two, stackvm.Plus}, nil, 0},
+		{"empty", []stackvm.Token{}, stackvm.ErrEmptyProgram, 0},
+		{"underflow", []stackvm.Token{stackvm.One, stackvm.Div, stackvm.Two}, stackvm.ErrStackUnderflow, 1},
+		{"unknown", []stackvm.Token{stackvm.One, stackvm.Token(-3)}, stackvm.ErrUnknownOpcode, 1},
+		{"missing operand", []stackvm.Token{stackvm.One, stackvm.Push}, stackvm.ErrMissingOperand, 1},
+		{"operand is not an opcode", []stackvm.Token{stackvm.Push, stackvm.Token(-3)}, nil, 0},
+		{"leftover", []stackvm.Token{stackvm.One, stackvm.Two, stackvm.Two, stackvm.Mult}, stackvm.ErrLeftoverStack, 4},
+		{"if", []stackvm.Token{stackvm.One, stackvm.JmpIfZero, 3, stackvm.Two, stackvm.Jmp, 1, stackvm.One}, nil, 0},
+		{"loop", []stackvm.Token{stackvm.One, stackvm.Jmp, -2}, stackvm.ErrNoExit, 3},
+		{"jump out of range", []stackvm.Token{stackvm.One, stackvm.Jmp, 1}, stackvm.ErrBadJump, 1},
+		{"jump into operand", []stackvm.Token{stackvm.Jmp, 1, stackvm.Push, stackvm.One}, stackvm.ErrBadJump, 0},
+		{"mismatch", []stackvm.Token{stackvm.One, stackvm.One, stackvm.JmpIfZero, 1, stackvm.One, stackvm.Plus}, stackvm.ErrStackMismatch, 5},
+		{"nothing left", []stackvm.Token{stackvm.One, stackvm.JmpIfZero, 0}, stackvm.ErrStackUnderflow, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := stackvm.Verify(test.code)
+			if test.err == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var verifyErr *stackvm.VerifyError
+			if !errors.As(err, &verifyErr) || !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if verifyErr.Index != test.index {
+				t.Errorf("expected index %d, got %d", test.index, verifyErr.Index)
+			}
+		})
+	}
+}
+
+func TestStackDepths(t *testing.T) {
+	// if x0 then 1 else 2
+	code := []stackvm.Token{stackvm.Load, 0, stackvm.JmpIfZero, 3, stackvm.One, stackvm.Jmp, 1, stackvm.Two}
+	depths, err := stackvm.StackDepths(code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{0, -1, 1, -1, 0, 1, -1, 0, 1}; !slices.Equal(depths, expected) {
+		t.Errorf("expected %v, got %v", expected, depths)
+	}
+
+	if _, err := stackvm.StackDepths([]stackvm.Token{stackvm.Plus}); !errors.Is(err, stackvm.ErrStackUnderflow) {
+		t.Errorf("expected %v, got %v", stackvm.ErrStackUnderflow, err)
+	}
+}
+
+// FuzzVerify uses the runtime checks of VM.TryRun as oracle for Verify on
+// straight-line programs.
+func FuzzVerify(f *testing.F) {
+	f.Add([]byte{3, 4, 0})
+	f.Add([]byte{3, 4, 4, 1, 2})
+	f.Add([]byte{3, 0})
+	f.Add([]byte{5, 7, 3, 2})
+	f.Add([]byte{9, 1, 10, 0, 3, 0})
+	f.Add([]byte{15})
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		// straight-line programs only, jumps may loop forever
+		code := fuzzcode.DecodeStraight(in)
+
+		// bind every variable index a byte can produce
+		staticErr := stackvm.Verify(code)
+		_, runtimeErr := stackvm.NewVM(code).RunWith(make(stackvm.Env, 16))
+
+		var verifyErr *stackvm.VerifyError
+		var runErr *stackvm.RunError
+		switch {
+		case staticErr == nil && runtimeErr == nil:
+		case errors.As(staticErr, &verifyErr) && errors.As(runtimeErr, &runErr):
+			if verifyErr.Err != runErr.Err || verifyErr.Index != runErr.PC {
+				t.Errorf("%s: Verify reports %v, TryRun reports %v", stackvm.Show(code), staticErr, runtimeErr)
+			}
+		default:
+			t.Errorf("%s: Verify reports %v, TryRun reports %v", stackvm.Show(code), staticErr, runtimeErr)
+		}
+	})
+}
+
+// FuzzVerifyControlFlow checks that programs accepted by Verify never fault at
+// runtime, apart from loops and variables Verify knows nothing about. Verify
+// looks at every path, so rejected programs may still run fine.
+func FuzzVerifyControlFlow(f *testing.F) {
+	f.Add([]byte{3, 14, 3, 4, 13, 1, 3})
+	f.Add([]byte{3, 13, 254})
+	f.Add([]byte{9, 0, 3, 12, 14, 251, 9, 0})
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		code := fuzzcode.Decode(in)
+
+		staticErr := stackvm.Verify(code)
+		_, runtimeErr := stackvm.NewVM(code, stackvm.WithMaxSteps(1000)).RunWith(make(stackvm.Env, 16))
+
+		if errors.Is(runtimeErr, stackvm.ErrOutOfGas) || errors.Is(runtimeErr, stackvm.ErrUnboundVariable) {
+			return
+		}
+		if staticErr == nil && runtimeErr != nil {
+			t.Errorf("%s: Verify accepts the program, TryRun reports %v", stackvm.Show(code), runtimeErr)
+		}
+	})
+}
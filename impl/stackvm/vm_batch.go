@@ -0,0 +1,64 @@
+package stackvm
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// BatchResult is the outcome of running programs[Index] in RunBatch, Value
+// and Err are what VM.RunContext returned for it.
+type BatchResult struct {
+	Index int
+	Value float64
+	Err   error
+}
+
+// RunBatch runs programs without variables on workers goroutines, each reusing
+// its state and stack like Pool does, with runs configured with opts, and
+// streams the results in the order they finish. workers <= 0 means
+// runtime.GOMAXPROCS(0). The channel is closed once every program ran or,
+// after ctx is done, once the workers stopped; running programs are aborted
+// like by VM.RunContext and programs that did not start are not reported.
+// Callers that stop reading early must cancel ctx to release the workers.
+func RunBatch(ctx context.Context, programs [][]Token, workers int, opts ...Option) <-chan BatchResult {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	indices := make(chan int)
+	go func() {
+		defer close(indices)
+		for i := range programs {
+			select {
+			case indices <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	results := make(chan BatchResult)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := newRunner(opts...)
+			for i := range indices {
+				r.vm.Reset(programs[i])
+				value, err := r.run(ctx, nil)
+				select {
+				case results <- BatchResult{Index: i, Value: value, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
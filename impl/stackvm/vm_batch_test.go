@@ -0,0 +1,62 @@
+package stackvm_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"project/impl/stackvm"
+	gen "project/impl/stackvm/generator"
+	"testing"
+)
+
+func TestRunBatch(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	programs := make([][]stackvm.Token, 500)
+	for i := range programs {
+		programs[i] = gen.RandomExp(rand, 4).Convert()
+	}
+	// a fault is reported with its index
+	programs[7] = []stackvm.Token{stackvm.One, stackvm.Plus}
+
+	seen := make([]bool, len(programs))
+	for result := range stackvm.RunBatch(context.Background(), programs, 4) {
+		if seen[result.Index] {
+			t.Fatalf("program %d reported twice", result.Index)
+		}
+		seen[result.Index] = true
+		if result.Index == 7 && !errors.Is(result.Err, stackvm.ErrStackUnderflow) {
+			t.Errorf("program 7: expected %v, got %v", stackvm.ErrStackUnderflow, result.Err)
+		}
+
+		expected, expectedErr := stackvm.NewVM(programs[result.Index]).TryRun()
+		if !errors.Is(result.Err, errors.Unwrap(expectedErr)) || !sameResult(result.Value, expected) {
+			t.Errorf("program %d: expected %g, %v, got %g, %v", result.Index, expected, expectedErr, result.Value, result.Err)
+		}
+	}
+	for i, ok := range seen {
+		if !ok {
+			t.Errorf("program %d not reported", i)
+		}
+	}
+}
+
+func TestRunBatchCancel(t *testing.T) {
+	programs := make([][]stackvm.Token, 1000)
+	for i := range programs {
+		programs[i] = []stackvm.Token{stackvm.One}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := stackvm.RunBatch(ctx, programs, 2)
+	<-results
+	cancel()
+
+	// the channel is closed without reporting every program
+	n := 1
+	for range results {
+		n++
+	}
+	if n == len(programs) {
+		t.Errorf("expected cancellation to stop the batch")
+	}
+}
@@ -0,0 +1,171 @@
+package stackvm
+
+import "math"
+
+// frame is the state a compiled program runs on. The stack depth before every
+// instruction is known statically, so the closures address their slots
+// directly and never keep a stack pointer.
+type frame struct {
+	stack []float64
+	env   Env
+	steps int
+	err   error
+}
+
+// compiled is an instruction translated into a closure. It returns the index
+// of the next instruction or -1 after setting the fault of f.
+type compiled func(f *frame) int
+
+// Compile translates codes once into Go closures, one per reachable
+// instruction, so running the program does not go through the switch of
+// VM.Run again. The returned function runs without variables. Compile panics
+// if Verify rejects codes and the function panics if the program faults, like
+// VM.Run does.
+func Compile(codes []Token) func() float64 {
+	run, err := CompileWith(codes)
+	if err != nil {
+		panic(err)
+	}
+	return func() float64 {
+		result, err := run(nil)
+		if err != nil {
+			panic(err)
+		}
+		return result
+	}
+}
+
+// CompileWith is Compile for programs with variables. It returns the error of
+// Verify instead of panicking, and the returned function reports faults like
+// VM.RunWith: a *RunError wrapping ErrUnboundVariable is the only fault left
+// once a program verifies. Compiled programs have no step limit.
+func CompileWith(codes []Token) (func(env Env) (float64, error), error) {
+	depths, err := StackDepths(codes)
+	if err != nil {
+		return nil, err
+	}
+
+	size := 0
+	ops := make([]compiled, len(codes))
+	for pc, depth := range depths[:len(codes)] {
+		if depth < 0 {
+			continue
+		}
+		ops[pc] = compileInstruction(codes, pc, depth)
+		size = max(size, depth+1)
+	}
+
+	return func(env Env) (float64, error) {
+		f := &frame{stack: make([]float64, size), env: env}
+		for pc := 0; pc < len(ops); f.steps++ {
+			if pc = ops[pc](f); pc < 0 {
+				return 0, f.err
+			}
+		}
+		// Verify guarantees a single value at the end
+		return f.stack[0], nil
+	}, nil
+}
+
+// compileInstruction translates the instruction at pc, which runs with depth
+// values on the stack.
+func compileInstruction(codes []Token, pc int, depth int) compiled {
+	top, below := depth-1, depth-2
+	next := pc + 1
+	if HasOperand(codes[pc]) {
+		next = pc + 2
+	}
+	fault := func(f *frame, err error) int {
+		f.err = newRunError(err, codes, pc, f.stack[:depth], f.steps)
+		return -1
+	}
+
+	switch codes[pc] {
+	case One, Two, Push:
+		value := 1.0
+		switch codes[pc] {
+		case Two:
+			value = 2
+		case Push:
+			value = float64(codes[pc+1])
+		}
+		return func(f *frame) int {
+			f.stack[depth] = value
+			return next
+		}
+	case Load:
+		index := int64(codes[pc+1])
+		return func(f *frame) int {
+			value, ok := f.env.lookup(index)
+			if !ok {
+				return fault(f, ErrUnboundVariable)
+			}
+			f.stack[depth] = value
+			return next
+		}
+	case Store:
+		index := int64(codes[pc+1])
+		return func(f *frame) int {
+			if _, ok := f.env.lookup(index); !ok {
+				return fault(f, ErrUnboundVariable)
+			}
+			f.env[index] = f.stack[top]
+			return next
+		}
+	case Neg:
+		return func(f *frame) int {
+			f.stack[top] = -f.stack[top]
+			return next
+		}
+	case Plus:
+		return func(f *frame) int {
+			f.stack[below] += f.stack[top]
+			return next
+		}
+	case Minus:
+		return func(f *frame) int {
+			f.stack[below] -= f.stack[top]
+			return next
+		}
+	case Mult:
+		return func(f *frame) int {
+			f.stack[below] *= f.stack[top]
+			return next
+		}
+	case Div:
+		// Div divides by the topmost value, see DivExp.Convert
+		return func(f *frame) int {
+			f.stack[below] /= f.stack[top]
+			return next
+		}
+	case Mod:
+		return func(f *frame) int {
+			f.stack[below] = math.Mod(f.stack[below], f.stack[top])
+			return next
+		}
+	case Eq:
+		return func(f *frame) int {
+			f.stack[below] = boolToFloat(f.stack[below] == f.stack[top])
+			return next
+		}
+	case Lt:
+		return func(f *frame) int {
+			f.stack[below] = boolToFloat(f.stack[below] < f.stack[top])
+			return next
+		}
+	case Jmp:
+		// Verify made sure that the target is an instruction
+		target, _ := jumpTarget(codes, pc)
+		return func(f *frame) int {
+			return target
+		}
+	default: // JmpIfZero
+		target, _ := jumpTarget(codes, pc)
+		return func(f *frame) int {
+			if f.stack[top] == 0 {
+				return target
+			}
+			return next
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package stackvm_test
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"project/impl/stackvm"
+	gen "project/impl/stackvm/generator"
+	"project/impl/stackvm/internal/fuzzcode"
+	"slices"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	// 1 x0 + 2 /
+	run, err := stackvm.CompileWith([]stackvm.Token{stackvm.One, stackvm.Load, 0, stackvm.Plus, stackvm.Two, stackvm.Div})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result, err := run(stackvm.Env{5}); err != nil || result != 3 {
+		t.Errorf("expected 3, got %g, %v", result, err)
+	}
+
+	// if x0 < 0 then -x0 else x0
+	code, _ := stackvm.Parse("x0 0 < jz 5 x0 neg jmp 2 x0")
+	run, err = stackvm.CompileWith(code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, x := range []float64{-3, 4} {
+		if result, err := run(stackvm.Env{x}); err != nil || result != math.Abs(x) {
+			t.Errorf("x0 = %g: expected %g, got %g, %v", x, math.Abs(x), result, err)
+		}
+	}
+
+	if result := stackvm.Compile([]stackvm.Token{stackvm.Two, stackvm.Push, 7, stackvm.Mult})(); result != 14 {
+		t.Errorf("expected 14, got %g", result)
+	}
+}
+
+func TestCompileFaults(t *testing.T) {
+	if _, err := stackvm.CompileWith([]stackvm.Token{stackvm.One, stackvm.Plus}); !errors.Is(err, stackvm.ErrStackUnderflow) {
+		t.Errorf("expected %v, got %v", stackvm.ErrStackUnderflow, err)
+	}
+
+	run, _ := stackvm.CompileWith([]stackvm.Token{stackvm.One, stackvm.Load, 3, stackvm.Plus})
+	_, err := run(nil)
+	var runErr *stackvm.RunError
+	if !errors.As(err, &runErr) || !errors.Is(err, stackvm.ErrUnboundVariable) {
+		t.Fatalf("expected %v, got %v", stackvm.ErrUnboundVariable, err)
+	}
+	if runErr.PC != 1 || runErr.Steps != 1 || !slices.Equal(runErr.Stack, []float64{1}) {
+		t.Errorf("expected fault at pc 1 after 1 step with stack [1], got %v", runErr)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected Compile to panic")
+		}
+	}()
+	stackvm.Compile([]stackvm.Token{stackvm.Plus})
+}
+
+// sameCompiled compares a run of the VM with a run of the compiled program,
+// including faults and assigned variables. Programs that run out of steps on
+// the VM are skipped, the compiled form would loop forever.
+func sameCompiled(t *testing.T, code []stackvm.Token, env stackvm.Env) {
+	t.Helper()
+	run, err := stackvm.CompileWith(code)
+	if err != nil {
+		t.Fatalf("%s: %v", stackvm.Show(code), err)
+	}
+
+	envVM, envCompiled := slices.Clone(env), slices.Clone(env)
+	expected, expectedErr := stackvm.NewVM(code, stackvm.WithMaxSteps(1000)).RunWith(envVM)
+	if errors.Is(expectedErr, stackvm.ErrOutOfGas) {
+		return
+	}
+	result, err := run(envCompiled)
+
+	if expectedErr != nil || err != nil {
+		var expectedRunErr, runErr *stackvm.RunError
+		if !errors.As(expectedErr, &expectedRunErr) || !errors.As(err, &runErr) ||
+			expectedRunErr.Err != runErr.Err || expectedRunErr.PC != runErr.PC || expectedRunErr.Steps != runErr.Steps ||
+			!slices.EqualFunc(expectedRunErr.Stack, runErr.Stack, sameResult) {
+			t.Fatalf("%s: VM reports %v, compiled program reports %v", stackvm.Show(code), expectedErr, err)
+		}
+		return
+	}
+	if !sameResult(result, expected) {
+		t.Errorf("%s: VM yields %g, compiled program yields %g", stackvm.Show(code), expected, result)
+	}
+	for i := range env {
+		if !sameResult(envVM[i], envCompiled[i]) {
+			t.Errorf("%s: VM assigns x%d = %g, compiled program %g", stackvm.Show(code), i, envVM[i], envCompiled[i])
+		}
+	}
+}
+
+// FuzzCompile runs generated expressions on the VM and compiled.
+func FuzzCompile(f *testing.F) {
+	f.Add(int64(1), 3.0, -2.0)
+	f.Add(int64(2), 0.0, 0.5)
+
+	f.Fuzz(func(t *testing.T, seed int64, x0, x1 float64) {
+		exp := gen.RandomExpWithVars(rand.New(rand.NewSource(seed)), 5, 2)
+		sameCompiled(t, exp.Convert(), stackvm.Env{x0, x1})
+	})
+}
+
+// FuzzCompileTokens runs arbitrary verified programs on the VM and compiled.
+func FuzzCompileTokens(f *testing.F) {
+	f.Add([]byte{3, 14, 3, 4, 13, 1, 3})
+	f.Add([]byte{9, 0, 3, 12, 14, 251, 9, 0})
+	f.Add([]byte{9, 20, 10, 1, 3, 2})
+	f.Add([]byte{9, 0, 9, 0, 9, 0, 2, 10, 199, 0})
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		code := fuzzcode.Decode(in)
+		if stackvm.Verify(code) != nil {
+			return
+		}
+		sameCompiled(t, code, make(stackvm.Env, 16))
+	})
+}
+
+// benchmarkProgram is a generated expression large enough for dispatch to
+// dominate the run time.
+func benchmarkProgram() []stackvm.Token {
+	return gen.RandomExpWithVars(rand.New(rand.NewSource(1)), 8, 2).Convert()
+}
+
+func BenchmarkRun(b *testing.B) {
+	vm := stackvm.NewVM(benchmarkProgram())
+	env := stackvm.Env{3, -2}
+	b.ReportAllocs()
+	for range b.N {
+		vm.RunWith(env)
+	}
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	run, err := stackvm.CompileWith(benchmarkProgram())
+	if err != nil {
+		b.Fatal(err)
+	}
+	env := stackvm.Env{3, -2}
+	b.ReportAllocs()
+	for range b.N {
+		run(env)
+	}
+}
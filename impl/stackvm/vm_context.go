@@ -0,0 +1,34 @@
+package stackvm
+
+import "context"
+
+// cancelCheckInterval is how many instructions RunWithContext executes between
+// checks for cancellation.
+const cancelCheckInterval = 1024
+
+// RunContext executes the program without variables until it halts or ctx is
+// done, see RunWithContext.
+func (vm *VM) RunContext(ctx context.Context) (float64, error) {
+	return vm.RunWithContext(ctx, nil)
+}
+
+// RunWithContext is RunWith that checks ctx before the first instruction and
+// then every cancelCheckInterval instructions. A run stopped by ctx is
+// reported as a *RunError wrapping ctx.Err() with the partial state: the next
+// instruction, the steps executed so far and the stack. Variables keep what
+// the run assigned until then.
+func (vm *VM) RunWithContext(ctx context.Context, env Env) (float64, error) {
+	return vm.run(ctx, env)
+}
+
+// canceled halts the run with the error of ctx if it is done.
+func (s *State) canceled(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+	default:
+		return false
+	}
+	s.Halted = true
+	s.Err = s.fault(ctx.Err())
+	return true
+}
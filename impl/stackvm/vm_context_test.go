@@ -0,0 +1,59 @@
+package stackvm_test
+
+import (
+	"context"
+	"errors"
+	"project/impl/stackvm"
+	"testing"
+	"time"
+)
+
+// loop never halts if x0 is 0: x0 jz -4 1
+var loop = []stackvm.Token{stackvm.Load, 0, stackvm.JmpIfZero, -4, stackvm.One}
+
+func TestRunContext(t *testing.T) {
+	vm := stackvm.NewVM([]stackvm.Token{stackvm.One, stackvm.Two, stackvm.Plus})
+	if result, err := vm.RunContext(context.Background()); err != nil || result != 3 {
+		t.Errorf("expected 3, got %g, %v", result, err)
+	}
+
+	// canceled before the first instruction
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := vm.RunContext(ctx)
+	var runErr *stackvm.RunError
+	if !errors.As(err, &runErr) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if runErr.PC != 0 || runErr.Steps != 0 {
+		t.Errorf("expected fault at pc 0 after 0 steps, got %v", runErr)
+	}
+}
+
+func TestRunContextTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := stackvm.NewVM(loop).RunWithContext(ctx, stackvm.Env{0})
+
+	var runErr *stackvm.RunError
+	if !errors.As(err, &runErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if runErr.Steps == 0 || runErr.Steps%1024 != 0 {
+		t.Errorf("expected the run to stop at a multiple of 1024 steps, got %v", runErr)
+	}
+}
+
+func TestRunBatchAbortsLoops(t *testing.T) {
+	// 1 1 - jz -5 1 never halts
+	programs := [][]stackvm.Token{{stackvm.One}, {stackvm.One, stackvm.One, stackvm.Minus, stackvm.JmpIfZero, -5, stackvm.One}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	// the batch ends although a program loops, its result may be dropped
+	for result := range stackvm.RunBatch(ctx, programs, 2) {
+		if result.Index == 1 && !errors.Is(result.Err, context.DeadlineExceeded) {
+			t.Errorf("expected %v, got %v", context.DeadlineExceeded, result.Err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package stackvm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Faults reported by VM.TryRun. They are wrapped in a *RunError, so use
+// errors.Is to classify them.
+var (
+	ErrStackUnderflow  = errors.New("stack underflow")
+	ErrUnknownOpcode   = errors.New("unknown opcode")
+	ErrMissingOperand  = errors.New("missing operand")
+	ErrUnboundVariable = errors.New("unbound variable")
+	ErrBadJump         = errors.New("jump target out of range")
+	ErrLeftoverStack   = errors.New("leftover values on stack")
+	ErrEmptyProgram    = errors.New("empty program")
+	ErrOutOfGas        = errors.New("step limit exceeded")
+	ErrStackOverflow   = errors.New("stack limit exceeded")
+)
+
+// RunError describes where a program faulted.
+// PC is the index of the faulting instruction (len(code) for faults detected
+// after the last instruction), Op the instruction itself (-1 past the end),
+// Steps the number of instructions executed before the fault and Stack a copy
+// of the stack at that point.
+type RunError struct {
+	Err   error
+	PC    int
+	Op    Token
+	Steps int
+	Stack []float64
+}
+
+func (e *RunError) Error() string {
+	return fmt.Sprintf("%v at pc %d after %d steps, stack %v", e.Err, e.PC, e.Steps, e.Stack)
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+func newRunError(err error, codes []Token, pc int, stack []float64, steps int) *RunError {
+	op := Token(-1)
+	if pc < len(codes) {
+		op = codes[pc]
+	}
+	snapshot := make([]float64, len(stack))
+	copy(snapshot, stack)
+	return &RunError{Err: err, PC: pc, Op: op, Steps: steps, Stack: snapshot}
+}
@@ -0,0 +1,61 @@
+package stackvm_test
+
+import (
+	"errors"
+	"project/impl/stackvm"
+	"testing"
+)
+
+func TestTryRunFaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  []stackvm.Token
+		err   error
+		pc    int
+		stack []float64
+	}{
+		{"empty", []stackvm.Token{}, stackvm.ErrEmptyProgram, 0, []float64{}},
+		{"underflow", []stackvm.Token{stackvm.One, stackvm.Plus}, stackvm.ErrStackUnderflow, 1, []float64{1}},
+		{"unknown", []stackvm.Token{stackvm.Two, stackvm.Token(42)}, stackvm.ErrUnknownOpcode, 1, []float64{2}},
+		{"missing operand", []stackvm.Token{stackvm.Two, stackvm.Push}, stackvm.ErrMissingOperand, 1, []float64{2}},
+		{"leftover", []stackvm.Token{stackvm.One, stackvm.Two}, stackvm.ErrLeftoverStack, 2, []float64{1, 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := stackvm.NewVM(test.code).TryRun()
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+
+			var runErr *stackvm.RunError
+			if !errors.As(err, &runErr) {
+				t.Fatalf("expected *RunError, got %T", err)
+			}
+			if runErr.PC != test.pc {
+				t.Errorf("expected pc %d, got %d", test.pc, runErr.PC)
+			}
+			if len(runErr.Stack) != len(test.stack) {
+				t.Fatalf("expected stack %v, got %v", test.stack, runErr.Stack)
+			}
+			for i := range test.stack {
+				if runErr.Stack[i] != test.stack[i] {
+					t.Errorf("expected stack %v, got %v", test.stack, runErr.Stack)
+				}
+			}
+		})
+	}
+}
+
+func TestTryRun(t *testing.T) {
+	// 2 / (1 + 1)
+	code := []stackvm.Token{stackvm.Two, stackvm.One, stackvm.One, stackvm.Plus, stackvm.Div}
+
+	result, err := stackvm.NewVM(code).TryRun()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != 1 {
+		t.Errorf("expected 1, got %g", result)
+	}
+}
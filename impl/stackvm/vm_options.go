@@ -0,0 +1,27 @@
+package stackvm
+
+// Option configures a VM created by NewVM.
+type Option func(*VM)
+
+// WithMaxSteps stops a run with ErrOutOfGas once n instructions have been
+// executed. Programs with backward jumps may otherwise never terminate.
+func WithMaxSteps(n int) Option {
+	return func(vm *VM) {
+		vm.maxSteps = n
+	}
+}
+
+// WithTracer calls t around every instruction the VM executes.
+func WithTracer(t Tracer) Option {
+	return func(vm *VM) {
+		vm.tracer = t
+	}
+}
+
+// WithMaxStackDepth stops a run with ErrStackOverflow before the stack grows
+// beyond n values.
+func WithMaxStackDepth(n int) Option {
+	return func(vm *VM) {
+		vm.maxStackDepth = n
+	}
+}
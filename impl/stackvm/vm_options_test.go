@@ -0,0 +1,50 @@
+package stackvm_test
+
+import (
+	"errors"
+	"project/impl/stackvm"
+	"testing"
+)
+
+func TestMaxSteps(t *testing.T) {
+	// jumps back to itself forever
+	code := []stackvm.Token{stackvm.Jmp, -2}
+
+	_, err := stackvm.NewVM(code, stackvm.WithMaxSteps(100)).TryRun()
+	if !errors.Is(err, stackvm.ErrOutOfGas) {
+		t.Fatalf("expected %v, got %v", stackvm.ErrOutOfGas, err)
+	}
+
+	var runErr *stackvm.RunError
+	if errors.As(err, &runErr) && runErr.Steps != 100 {
+		t.Errorf("expected 100 steps, got %d", runErr.Steps)
+	}
+}
+
+func TestMaxStackDepth(t *testing.T) {
+	// pushes forever
+	code := []stackvm.Token{stackvm.One, stackvm.Jmp, -3}
+
+	_, err := stackvm.NewVM(code, stackvm.WithMaxSteps(100), stackvm.WithMaxStackDepth(8)).TryRun()
+	if !errors.Is(err, stackvm.ErrStackOverflow) {
+		t.Fatalf("expected %v, got %v", stackvm.ErrStackOverflow, err)
+	}
+
+	var runErr *stackvm.RunError
+	if errors.As(err, &runErr) && (len(runErr.Stack) != 8 || runErr.Steps != 16) {
+		t.Errorf("expected 8 values after 16 steps, got %d after %d", len(runErr.Stack), runErr.Steps)
+	}
+}
+
+func TestLimitsNotReached(t *testing.T) {
+	// 1 + 2 needs three steps and two stack slots
+	code := []stackvm.Token{stackvm.One, stackvm.Two, stackvm.Plus}
+
+	result, err := stackvm.NewVM(code, stackvm.WithMaxSteps(3), stackvm.WithMaxStackDepth(2)).TryRun()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != 3 {
+		t.Errorf("expected 3, got %g", result)
+	}
+}
@@ -0,0 +1,55 @@
+package stackvm
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool runs programs on runners that are reused across runs and goroutines,
+// so a fuzz loop that runs a new program every iteration stops allocating a
+// state and a stack each time. A Pool is safe for concurrent use.
+type Pool struct {
+	pool sync.Pool
+}
+
+// NewPool returns a Pool whose runs are configured with opts.
+func NewPool(opts ...Option) *Pool {
+	p := &Pool{}
+	p.pool.New = func() any {
+		return newRunner(opts...)
+	}
+	return p
+}
+
+// Run executes codes with variables bound to env like VM.RunWith. Once the
+// runners have grown stacks deep enough for the programs, runs do not
+// allocate unless they fault.
+func (p *Pool) Run(codes []Token, env Env) (float64, error) {
+	r := p.pool.Get().(*runner)
+	defer p.pool.Put(r)
+	r.vm.Reset(codes)
+	return r.run(nil, env)
+}
+
+// runner runs the program of its VM again and again on the same state and
+// stack, which grows to the deepest stack any run needed. It is not safe for
+// concurrent use.
+type runner struct {
+	vm    *VM
+	state State
+	stack []float64 // empty
+}
+
+func newRunner(opts ...Option) *runner {
+	return &runner{vm: NewVM(nil, opts...)}
+}
+
+// run is VM.run on the state and stack of r.
+func (r *runner) run(ctx context.Context, env Env) (float64, error) {
+	s := &r.state
+	r.vm.start(s, env, r.stack[:0])
+	result, err := s.run(ctx)
+	r.stack = s.Stack[:0]
+	s.Env = nil
+	return result, err
+}
@@ -0,0 +1,106 @@
+package stackvm_test
+
+import (
+	"errors"
+	"math/rand"
+	"project/impl/stackvm"
+	gen "project/impl/stackvm/generator"
+	"sync"
+	"testing"
+)
+
+func TestReset(t *testing.T) {
+	vm := stackvm.NewVM([]stackvm.Token{stackvm.One, stackvm.Two, stackvm.Plus})
+	if result, err := vm.TryRun(); err != nil || result != 3 {
+		t.Errorf("expected 3, got %g, %v", result, err)
+	}
+
+	vm.Reset([]stackvm.Token{stackvm.Two, stackvm.Two, stackvm.Two, stackvm.Mult, stackvm.Mult})
+	if result, err := vm.TryRun(); err != nil || result != 8 {
+		t.Errorf("expected 8, got %g, %v", result, err)
+	}
+
+	// programs that fail Verify still run and fault
+	vm.Reset([]stackvm.Token{stackvm.One, stackvm.Plus})
+	if _, err := vm.TryRun(); !errors.Is(err, stackvm.ErrStackUnderflow) {
+		t.Errorf("expected %v, got %v", stackvm.ErrStackUnderflow, err)
+	}
+	vm.Reset(nil)
+	if _, err := vm.TryRun(); !errors.Is(err, stackvm.ErrEmptyProgram) {
+		t.Errorf("expected %v, got %v", stackvm.ErrEmptyProgram, err)
+	}
+}
+
+func TestResetKeepsOptions(t *testing.T) {
+	vm := stackvm.NewVM([]stackvm.Token{stackvm.One}, stackvm.WithMaxSteps(2))
+	vm.Reset([]stackvm.Token{stackvm.One, stackvm.One, stackvm.Plus})
+	if _, err := vm.TryRun(); !errors.Is(err, stackvm.ErrOutOfGas) {
+		t.Errorf("expected %v, got %v", stackvm.ErrOutOfGas, err)
+	}
+}
+
+func TestSharedVM(t *testing.T) {
+	// runs do not share state, so one VM can run on several goroutines
+	code := gen.RandomExpWithVars(rand.New(rand.NewSource(1)), 6, 2).Convert()
+	vm := stackvm.NewVM(code)
+	expected, err := vm.RunWith(stackvm.Env{3, -2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if result, err := vm.RunWith(stackvm.Env{3, -2}); err != nil || !sameResult(result, expected) {
+					t.Errorf("expected %g, got %g, %v", expected, result, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPool(t *testing.T) {
+	pool := stackvm.NewPool(stackvm.WithMaxSteps(1000))
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rand := rand.New(rand.NewSource(int64(i)))
+			for range 100 {
+				exp := gen.RandomExpWithVars(rand, 4, 2)
+				expected, expectedErr := stackvm.NewVM(exp.Convert(), stackvm.WithMaxSteps(1000)).RunWith(stackvm.Env{1.5, -3})
+				result, err := pool.Run(exp.Convert(), stackvm.Env{1.5, -3})
+				if !errors.Is(err, errors.Unwrap(expectedErr)) || !sameResult(result, expected) {
+					t.Errorf("%s: expected %g, %v, got %g, %v", exp, expected, expectedErr, result, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkNewVMRun(b *testing.B) {
+	code := benchmarkProgram()
+	env := stackvm.Env{3, -2}
+	b.ReportAllocs()
+	for range b.N {
+		stackvm.NewVM(code).RunWith(env)
+	}
+}
+
+func BenchmarkPool(b *testing.B) {
+	pool := stackvm.NewPool()
+	code := benchmarkProgram()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		env := stackvm.Env{3, -2}
+		for pb.Next() {
+			pool.Run(code, env)
+		}
+	})
+}
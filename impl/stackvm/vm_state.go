@@ -0,0 +1,234 @@
+package stackvm
+
+import (
+	"context"
+	"math"
+)
+
+// State is a resumable run of a VM, see VM.Start. The exported fields must
+// not be modified.
+type State struct {
+	vm       *VM
+	breakPCs map[int]bool
+	breakOps map[Token]bool
+
+	Env    Env
+	PC     int       // next instruction
+	Stack  []float64 // top of the stack last
+	Steps  int       // executed instructions
+	Halted bool      // set once the run finished or faulted
+	Result float64   // the result of a run that halted without fault
+	Err    error     // the fault of a run that halted with one
+}
+
+// Start prepares a run of the program with variables bound to env without
+// executing anything yet.
+func (vm *VM) Start(env Env) *State {
+	s := &State{}
+	vm.start(s, env, []float64{})
+	return s
+}
+
+// start resets s to a run that has not executed anything and pushes onto
+// stack, which must be empty, so a runner can reuse both.
+func (vm *VM) start(s *State, env Env, stack []float64) {
+	*s = State{vm: vm, Env: env, Stack: stack}
+	if len(vm.codes) == 0 {
+		s.Halted = true
+		s.Err = s.fault(ErrEmptyProgram)
+	}
+}
+
+// Step executes a single instruction and returns the fault of the run, if any.
+// Stepping a halted run does nothing.
+func (s *State) Step() error {
+	if s.Halted {
+		return s.Err
+	}
+
+	if err := s.step(); err != nil {
+		s.Halted = true
+		s.Err = err
+		return err
+	}
+
+	if s.PC >= len(s.vm.codes) {
+		s.Halted = true
+		switch {
+		case len(s.Stack) == 0:
+			s.Err = s.fault(ErrStackUnderflow)
+		case len(s.Stack) > 1:
+			s.Err = s.fault(ErrLeftoverStack)
+		default:
+			s.Result = s.Stack[0]
+		}
+	}
+	return s.Err
+}
+
+// run steps until the run halts or, if ctx is not nil, ctx is done.
+func (s *State) run(ctx context.Context) (float64, error) {
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	for !s.Halted {
+		if done != nil && s.Steps%cancelCheckInterval == 0 && s.canceled(ctx) {
+			break
+		}
+		s.Step()
+	}
+	return s.Result, s.Err
+}
+
+// Continue steps until the run halts or the next instruction hits a
+// breakpoint. The current instruction is always executed, so Continue resumes
+// from a breakpoint.
+func (s *State) Continue() error {
+	for {
+		err := s.Step()
+		if s.Halted {
+			return err
+		}
+		if s.breakPCs[s.PC] || s.breakOps[s.vm.codes[s.PC]] {
+			return nil
+		}
+	}
+}
+
+// BreakAt makes Continue stop before the instruction at pc.
+func (s *State) BreakAt(pc int) {
+	if s.breakPCs == nil {
+		s.breakPCs = map[int]bool{}
+	}
+	s.breakPCs[pc] = true
+}
+
+// BreakOn makes Continue stop before every op instruction.
+func (s *State) BreakOn(op Token) {
+	if s.breakOps == nil {
+		s.breakOps = map[Token]bool{}
+	}
+	s.breakOps[op] = true
+}
+
+// ClearAt removes the breakpoint set by BreakAt.
+func (s *State) ClearAt(pc int) {
+	delete(s.breakPCs, pc)
+}
+
+// ClearOn removes the breakpoint set by BreakOn.
+func (s *State) ClearOn(op Token) {
+	delete(s.breakOps, op)
+}
+
+func (s *State) fault(err error) *RunError {
+	return newRunError(err, s.vm.codes, s.PC, s.Stack, s.Steps)
+}
+
+// step executes the instruction at s.PC. Faults leave the state untouched.
+func (s *State) step() error {
+	vm := s.vm
+	pc := s.PC
+	stack := s.Stack
+	if vm.maxSteps > 0 && s.Steps >= vm.maxSteps {
+		return s.fault(ErrOutOfGas)
+	}
+
+	code := vm.codes[pc]
+	next := pc + 1
+	if HasOperand(code) {
+		if pc+1 >= len(vm.codes) {
+			return s.fault(ErrMissingOperand)
+		}
+		next = pc + 2
+	}
+	if pops, pushes, _ := stackEffect(code); vm.maxStackDepth > 0 && len(stack)-pops+pushes > vm.maxStackDepth {
+		return s.fault(ErrStackOverflow)
+	}
+	if vm.tracer != nil {
+		vm.tracer.Before(pc, code, stack)
+	}
+
+	switch code {
+	case One:
+		stack = append(stack, 1)
+	case Two:
+		stack = append(stack, 2)
+	case Push:
+		stack = append(stack, float64(s.vm.codes[pc+1]))
+	case Load:
+		value, ok := s.Env.lookup(int64(s.vm.codes[pc+1]))
+		if !ok {
+			return s.fault(ErrUnboundVariable)
+		}
+		stack = append(stack, value)
+	case Store:
+		if len(stack) < 1 {
+			return s.fault(ErrStackUnderflow)
+		}
+		index := int64(s.vm.codes[pc+1])
+		if _, ok := s.Env.lookup(index); !ok {
+			return s.fault(ErrUnboundVariable)
+		}
+		s.Env[index] = stack[len(stack)-1]
+	case Neg:
+		if len(stack) < 1 {
+			return s.fault(ErrStackUnderflow)
+		}
+		stack[len(stack)-1] = -stack[len(stack)-1]
+	case Mult, Plus, Div, Minus, Mod, Eq, Lt:
+		if len(stack) < 2 {
+			return s.fault(ErrStackUnderflow)
+		}
+		var right = stack[len(stack)-1]
+		var left = stack[len(stack)-2]
+		stack = stack[:len(stack)-2]
+		switch code {
+		case Mult:
+			stack = append(stack, left*right)
+		case Plus:
+			stack = append(stack, left+right)
+		case Div:
+			// Div pops the divisor first, see DivExp.Convert
+			stack = append(stack, left/right)
+		case Minus:
+			stack = append(stack, left-right)
+		case Mod:
+			stack = append(stack, math.Mod(left, right))
+		case Eq:
+			stack = append(stack, boolToFloat(left == right))
+		case Lt:
+			stack = append(stack, boolToFloat(left < right))
+		}
+	case Jmp:
+		target, ok := jumpTarget(s.vm.codes, pc)
+		if !ok {
+			return s.fault(ErrBadJump)
+		}
+		next = target
+	case JmpIfZero:
+		if len(stack) < 1 {
+			return s.fault(ErrStackUnderflow)
+		}
+		target, ok := jumpTarget(s.vm.codes, pc)
+		if !ok {
+			return s.fault(ErrBadJump)
+		}
+		var cond = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if cond == 0 {
+			next = target
+		}
+	default:
+		return s.fault(ErrUnknownOpcode)
+	}
+	if vm.tracer != nil {
+		vm.tracer.After(pc, code, stack)
+	}
+
+	s.PC = next
+	s.Stack = stack
+	s.Steps++
+	return nil
+}
@@ -0,0 +1,91 @@
+package stackvm_test
+
+import (
+	"errors"
+	"project/impl/stackvm"
+	"testing"
+)
+
+func TestStep(t *testing.T) {
+	// 1 + 2
+	code := []stackvm.Token{stackvm.One, stackvm.Push, 2, stackvm.Plus}
+	s := stackvm.NewVM(code).Start(nil)
+
+	pcs := []int{1, 3, 4}
+	for i, pc := range pcs {
+		if err := s.Step(); err != nil {
+			t.Fatalf("step %d: unexpected error: %v", i, err)
+		}
+		if s.PC != pc {
+			t.Errorf("step %d: expected pc %d, got %d", i, pc, s.PC)
+		}
+	}
+
+	if !s.Halted || s.Result != 3 || s.Steps != 3 {
+		t.Errorf("expected halted run with result 3 after 3 steps, got %+v", s)
+	}
+	if err := s.Step(); err != nil || s.Steps != 3 {
+		t.Errorf("stepping a halted run should do nothing, got %v after %d steps", err, s.Steps)
+	}
+}
+
+func TestStepFault(t *testing.T) {
+	code := []stackvm.Token{stackvm.One, stackvm.Plus}
+	s := stackvm.NewVM(code).Start(nil)
+
+	if err := s.Step(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := s.Step()
+	if !errors.Is(err, stackvm.ErrStackUnderflow) {
+		t.Fatalf("expected %v, got %v", stackvm.ErrStackUnderflow, err)
+	}
+	if !s.Halted || s.Err != err || s.PC != 1 {
+		t.Errorf("expected halted run at pc 1, got %+v", s)
+	}
+
+	empty := stackvm.NewVM([]stackvm.Token{}).Start(nil)
+	if !empty.Halted || !errors.Is(empty.Step(), stackvm.ErrEmptyProgram) {
+		t.Errorf("expected %v, got %+v", stackvm.ErrEmptyProgram, empty)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	// (1 + 2) * (2 + 1)
+	code := []stackvm.Token{stackvm.One, stackvm.Two, stackvm.Plus, stackvm.Two, stackvm.One, stackvm.Plus, stackvm.Mult}
+	s := stackvm.NewVM(code).Start(nil)
+	s.BreakAt(3)
+	s.BreakOn(stackvm.Plus)
+
+	for _, pc := range []int{2, 3, 5} {
+		if err := s.Continue(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if s.Halted || s.PC != pc {
+			t.Fatalf("expected break at pc %d, got %+v", pc, s)
+		}
+	}
+
+	if err := s.Continue(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !s.Halted || s.Result != 9 {
+		t.Errorf("expected halted run with result 9, got %+v", s)
+	}
+}
+
+func TestClearBreakpoints(t *testing.T) {
+	code := []stackvm.Token{stackvm.One, stackvm.Two, stackvm.Plus, stackvm.Two, stackvm.Mult}
+	s := stackvm.NewVM(code).Start(nil)
+	s.BreakAt(3)
+	s.BreakOn(stackvm.Mult)
+	s.ClearAt(3)
+	s.ClearOn(stackvm.Mult)
+
+	if err := s.Continue(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !s.Halted || s.Result != 6 {
+		t.Errorf("expected halted run with result 6, got %+v", s)
+	}
+}
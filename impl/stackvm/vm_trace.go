@@ -0,0 +1,57 @@
+package stackvm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Tracer observes a VM run. Before and After are called around each
+// instruction, After is skipped if the instruction faults. The stack is the
+// VM's own and must not be modified or retained.
+type Tracer interface {
+	Before(pc int, op Token, stack []float64)
+	After(pc int, op Token, stack []float64)
+}
+
+// TableTracer writes one row per executed instruction with the stack after it:
+//
+//	pc | op       | stack
+//	 0 | 1        | [1]
+//	 1 | 2        | [1 2]
+//	 2 | +        | [3]
+type TableTracer struct {
+	w      io.Writer
+	codes  []Token
+	header bool
+}
+
+// NewTableTracer renders the run of codes to w. The program is needed to show
+// the operands of instructions.
+func NewTableTracer(w io.Writer, codes []Token) *TableTracer {
+	return &TableTracer{w: w, codes: codes}
+}
+
+func (t *TableTracer) Before(pc int, op Token, stack []float64) {
+	if !t.header {
+		t.header = true
+		fmt.Fprintf(t.w, "%4s | %-8s | %s\n", "pc", "op", "stack")
+	}
+}
+
+func (t *TableTracer) After(pc int, op Token, stack []float64) {
+	instruction, _ := ShowInstruction(t.codes, pc)
+	fmt.Fprintf(t.w, "%4d | %-8s | %v\n", pc, instruction, stack)
+}
+
+// Trace runs codes with env and returns the table a TableTracer renders, plus
+// the fault if there is one.
+func Trace(codes []Token, env Env, opts ...Option) string {
+	var builder strings.Builder
+	tracer := NewTableTracer(&builder, codes)
+	_, err := NewVM(codes, append(opts, WithTracer(tracer))...).RunWith(env)
+	if err != nil {
+		fmt.Fprintf(&builder, "%v\n", err)
+	}
+	return builder.String()
+}
@@ -0,0 +1,50 @@
+package stackvm_test
+
+import (
+	"project/impl/stackvm"
+	"testing"
+)
+
+type recordingTracer struct {
+	before []int
+	after  []int
+}
+
+func (r *recordingTracer) Before(pc int, op stackvm.Token, stack []float64) {
+	r.before = append(r.before, pc)
+}
+
+func (r *recordingTracer) After(pc int, op stackvm.Token, stack []float64) {
+	r.after = append(r.after, pc)
+}
+
+func TestTracer(t *testing.T) {
+	// 1 + 2, then a fault
+	code := []stackvm.Token{stackvm.One, stackvm.Push, 2, stackvm.Plus, stackvm.Plus}
+	tracer := &recordingTracer{}
+
+	_, err := stackvm.NewVM(code, stackvm.WithTracer(tracer)).TryRun()
+	if err == nil {
+		t.Fatal("expected a fault")
+	}
+
+	if len(tracer.before) != 4 || tracer.before[3] != 4 {
+		t.Errorf("expected Before at pc 0 1 3 4, got %v", tracer.before)
+	}
+	if len(tracer.after) != 3 || tracer.after[2] != 3 {
+		t.Errorf("expected After at pc 0 1 3, got %v", tracer.after)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	code := []stackvm.Token{stackvm.Load, 0, stackvm.Push, 5, stackvm.Div}
+
+	expected := "" +
+		"  pc | op       | stack\n" +
+		"   0 | x0       | [10]\n" +
+		"   2 | 5        | [10 5]\n" +
+		"   4 | /        | [2]\n"
+	if trace := stackvm.Trace(code, stackvm.Env{10}); trace != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, trace)
+	}
+}